@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/ids"
+	"github.com/spigell/anki-sync/internal/logging"
+	"github.com/spigell/anki-sync/internal/parser"
+)
+
+type AssignIDsCmd struct {
+	command *cobra.Command
+}
+
+func NewAssignIDsCmd(_ context.Context, logger *logging.Logger) *AssignIDsCmd {
+	c := &AssignIDsCmd{}
+	c.command = &cobra.Command{
+		Use:   "assign-ids",
+		Short: "Give every note without an id a generated one and write it to the deck files",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			decks, err := loadDecks(logger)
+			if err != nil {
+				return err
+			}
+			decks = slices.DeleteFunc(decks, func(d anki.Deck) bool {
+				switch {
+				case !d.ReadOnly:
+				case parser.IsTable(d.Source):
+					logger.Warn("ids can't be written to table decks, fill its id column instead", zap.String("file", d.Source))
+				default:
+					logger.Warn("ids can't be written to Markdown decks, set them by hand", zap.String("file", d.Source))
+				}
+				return d.ReadOnly
+			})
+
+			assigned, err := ids.Assign(decks, Config.DryRun)
+			if err != nil {
+				return err
+			}
+
+			for _, a := range assigned {
+				l := logger.CloneWith(
+					zap.String("file", location(a.Path, a.Line)),
+					zap.String("deck", a.Deck),
+					zap.String("note", a.Key),
+					zap.String("id", a.ID),
+				)
+				if Config.DryRun {
+					l.DryRunLogger().Info("would assign id")
+					continue
+				}
+				l.Info("id assigned")
+			}
+
+			logger.Info("ids assigned", zap.Int("notes", len(assigned)))
+			return nil
+		},
+	}
+	return c
+}
+
+func (c *AssignIDsCmd) Command() *cobra.Command {
+	return c.command
+}
+
+func (c *AssignIDsCmd) SetFlags() {
+	addSourceFlags(c.command.Flags())
+	addStrictFlag(c.command.Flags())
+}
+
+func (c *AssignIDsCmd) Validate() error {
+	if Config.Decks == "" {
+		return errors.New("--decks or config.decks must be set")
+	}
+	return nil
+}
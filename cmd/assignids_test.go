@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestAssignIDsReadOnlyDecks(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "words.csv"), "# deck_name: English\n# model_name: Basic\n# primary_field: Front\nFront,Back\ncat,кошка\n")
+	writeFile(t, filepath.Join(dir, "go.md"), "---\ndeck_name: Go\nmodel_name: Basic\nprimary_field: Front\nfields: [Back]\n---\n# defer\nRuns a call on return.\n")
+	deckFile := filepath.Join(dir, "animals.yaml")
+	writeFile(t, deckFile, "deck_name: Animals\nmodel_name: Basic\nprimary_field: Front\nnotes:\n  - fields:\n      Front: dog\n      Back: собака\n")
+	setConfig(t, AppConfig{Decks: dir})
+
+	logger, logs := observedLogger()
+	c := NewAssignIDsCmd(context.Background(), logger)
+	if err := c.Command().RunE(c.Command(), nil); err != nil {
+		t.Fatalf("assign-ids error = %v", err)
+	}
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{file: "words.csv", want: "fill its id column instead"},
+		{file: "go.md", want: "set them by hand"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			found := logs.FilterLevelExact(zap.WarnLevel).FilterField(zap.String("file", filepath.Join(dir, tt.file))).All()
+			if len(found) != 1 || !strings.Contains(found[0].Message, tt.want) {
+				t.Errorf("warnings for %s = %v, want one containing %q", tt.file, found, tt.want)
+			}
+		})
+	}
+
+	data, err := os.ReadFile(deckFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "id: ") {
+		t.Errorf("YAML deck has no id assigned:\n%s", data)
+	}
+}
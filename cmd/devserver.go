@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/spigell/anki-sync/internal/devserver"
+	"github.com/spigell/anki-sync/internal/logging"
+)
+
+type DevServerCmd struct {
+	command *cobra.Command
+	listen  string
+	state   string
+}
+
+func NewDevServerCmd(ctx context.Context, logger *logging.Logger) *DevServerCmd {
+	c := &DevServerCmd{}
+	c.command = &cobra.Command{
+		Use:   "dev-server",
+		Short: "Run a local AnkiConnect emulator for development and tests",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			srv, err := devserver.New(c.state)
+			if err != nil {
+				return fmt.Errorf("load dev-server state: %w", err)
+			}
+
+			if err := srv.Start(c.listen); err != nil {
+				return fmt.Errorf("start dev-server: %w", err)
+			}
+			defer srv.Close()
+
+			logger.Info("AnkiConnect emulator is listening", zap.String("url", srv.URL()), zap.String("state", c.state))
+
+			<-ctx.Done()
+
+			logger.Info("AnkiConnect emulator is stopped")
+			return nil
+		},
+	}
+	return c
+}
+
+func (c *DevServerCmd) Command() *cobra.Command {
+	return c.command
+}
+
+func (c *DevServerCmd) SetFlags() {
+	c.command.Flags().StringVar(&c.listen, "listen", "127.0.0.1:8765", "Address to listen on")
+	c.command.Flags().StringVar(&c.state, "state", "anki-dev-state.json", "JSON file keeping the emulated collection (empty for in-memory)")
+}
+
+func (c *DevServerCmd) Validate() error {
+	if c.listen == "" {
+		return fmt.Errorf("--listen must be set")
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/export"
+	"github.com/spigell/anki-sync/internal/logging"
+)
+
+type ExportCmd struct {
+	command *cobra.Command
+	all     bool
+	decks   []string
+	out     string
+	adopt   bool
+}
+
+func NewExportCmd(ctx context.Context, logger *logging.Logger) *ExportCmd {
+	c := &ExportCmd{}
+	c.command = &cobra.Command{
+		Use:   "export",
+		Short: "Write decks from Anki as anki-sync deck files and models.yaml",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			exporter := export.NewExporter(ctx, anki.NewClient(Config.AnkiURL), logger)
+
+			names := c.decks
+			if c.all {
+				var err error
+				if names, err = exporter.DeckNames(); err != nil {
+					return err
+				}
+			}
+
+			return exportDecks(exporter, logger, names, c.out, c.adopt)
+		},
+	}
+	return c
+}
+
+// exportDecks writes the named decks and their models under dir.
+func exportDecks(exporter *export.Exporter, logger *logging.Logger, names []string, dir string, adopt bool) error {
+	var decks []anki.Deck
+	for _, name := range names {
+		d, err := exporter.Deck(name)
+		if err != nil {
+			return err
+		}
+		decks = append(decks, d...)
+	}
+
+	written, err := export.Write(dir, decks, exporter.Models())
+	if err != nil {
+		return err
+	}
+	logger.Info("decks exported", zap.Int("decks", len(names)), zap.Strings("files", written))
+
+	if adopt {
+		return exporter.Adopt()
+	}
+	return nil
+}
+
+func (c *ExportCmd) Command() *cobra.Command {
+	return c.command
+}
+
+func (c *ExportCmd) SetFlags() {
+	c.command.Flags().BoolVar(&c.all, "all", false, "Export every deck holding notes")
+	c.command.Flags().StringArrayVar(&c.decks, "deck", nil, "Deck to export (repeatable)")
+	c.command.Flags().StringVar(&c.out, "out", ".", "Directory to write the deck files and models.yaml to")
+	c.command.Flags().BoolVar(&c.adopt, "adopt", true, "Tag the exported notes as managed by anki-sync, so that the next sync has nothing to change")
+}
+
+func (c *ExportCmd) Validate() error {
+	if c.all == (len(c.decks) > 0) {
+		return errors.New("either --all or --deck must be set")
+	}
+	return nil
+}
@@ -3,11 +3,14 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"slices"
 
 	"github.com/spf13/cobra"
+	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
 
 	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/export"
 	"github.com/spigell/anki-sync/internal/logging"
 )
 
@@ -27,6 +30,8 @@ func NewGetCmd(ctx context.Context, logger *logging.Logger) *GetCmd {
 	// add subcommands
 	modelCmd := newGetModelCmd(ctx, logger)
 	getCmd.AddCommand(modelCmd.Command)
+	deckCmd := newGetDeckCmd(ctx, logger)
+	getCmd.AddCommand(deckCmd.Command)
 
 	return c
 }
@@ -40,6 +45,8 @@ type GetModelCmd struct {
 	ctx    context.Context
 	logger *logging.Logger
 	name   string
+	split  bool
+	out    string
 
 	Command *cobra.Command
 }
@@ -52,6 +59,8 @@ func newGetModelCmd(ctx context.Context, logger *logging.Logger) *GetModelCmd {
 		RunE:  g.runE,
 	}
 	cmd.Flags().StringVar(&g.name, "name", "", "Model name")
+	cmd.Flags().BoolVar(&g.split, "split", false, "Write the CSS and templates to separate files referenced from models.yaml")
+	cmd.Flags().StringVar(&g.out, "out", ".", "Directory to write the split model to")
 	cmd.MarkFlagRequired("name")
 	g.Command = cmd
 	return g
@@ -82,6 +91,15 @@ func (g *GetModelCmd) runE(_ *cobra.Command, _ []string) error {
 		CardTemplates: templates,
 	}
 
+	if g.split {
+		written, err := export.Split(g.out, model)
+		if err != nil {
+			return err
+		}
+		g.logger.Info("model written", zap.String("model", g.name), zap.Strings("files", written))
+		return nil
+	}
+
 	out, err := yaml.Marshal(model)
 	if err != nil {
 		return err
@@ -90,3 +108,60 @@ func (g *GetModelCmd) runE(_ *cobra.Command, _ []string) error {
 	fmt.Print(string(out))
 	return nil
 }
+
+// get deck command.
+type GetDeckCmd struct {
+	ctx    context.Context
+	logger *logging.Logger
+	name   string
+	out    string
+	adopt  bool
+
+	Command *cobra.Command
+}
+
+func newGetDeckCmd(ctx context.Context, logger *logging.Logger) *GetDeckCmd {
+	g := &GetDeckCmd{ctx: ctx, logger: logger}
+	cmd := &cobra.Command{
+		Use:   "deck",
+		Short: "Get notes of a deck in the anki-sync deck format",
+		RunE:  g.runE,
+	}
+	cmd.Flags().StringVar(&g.name, "name", "", "Deck name")
+	cmd.Flags().StringVar(&g.out, "out", "", "Write the deck files and models.yaml to a directory instead of printing the deck")
+	cmd.Flags().BoolVar(&g.adopt, "adopt", false, "Tag the exported notes as managed by anki-sync")
+	cmd.MarkFlagRequired("name")
+	g.Command = cmd
+	return g
+}
+
+func (g *GetDeckCmd) runE(_ *cobra.Command, _ []string) error {
+	exporter := export.NewExporter(g.ctx, anki.NewClient(Config.AnkiURL), g.logger)
+
+	if g.out != "" {
+		return exportDecks(exporter, g.logger, []string{g.name}, g.out, g.adopt)
+	}
+
+	decks, err := exporter.Deck(g.name)
+	if err != nil {
+		return err
+	}
+	models := exporter.Models()
+
+	for i, d := range decks {
+		m := slices.IndexFunc(models, func(m anki.Model) bool { return m.Name == d.Model })
+		out, err := export.Marshal(d, models[m])
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Print("---\n")
+		}
+		fmt.Print(string(out))
+	}
+
+	if g.adopt {
+		return exporter.Adopt()
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/spigell/anki-sync/internal/logging"
+)
+
+// basicModel is a models file with the stock Basic note type.
+const basicModel = "name: Basic\nfields: [Front, Back]\ncardTemplates:\n  - name: Card 1\n    front: \"{{Front}}\"\n    back: \"{{Back}}\"\n"
+
+// setConfig replaces the global configuration for the duration of a test.
+func setConfig(t *testing.T, cfg AppConfig) {
+	t.Helper()
+	saved := *Config
+	*Config = cfg
+	t.Cleanup(func() { *Config = saved })
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mkdir(t *testing.T, path string) {
+	t.Helper()
+	if err := os.Mkdir(path, 0o700); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func observedLogger() (*logging.Logger, *observer.ObservedLogs) {
+	core, logs := observer.New(zap.InfoLevel)
+	return &logging.Logger{Logger: zap.New(core)}, logs
+}
+
+// execute runs the root command with args and a logger discarding output.
+func execute(t *testing.T, args ...string) error {
+	t.Helper()
+	logger := &Logger{Instance: &logging.Logger{Logger: zap.NewNop()}, Level: zap.NewAtomicLevel()}
+	root := NewRootCmd(context.Background(), logger)
+	root.SilenceErrors = true
+	root.SilenceUsage = true
+	root.SetArgs(args)
+	return root.Execute()
+}
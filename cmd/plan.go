@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/deck"
+	"github.com/spigell/anki-sync/internal/model"
+	"github.com/spigell/anki-sync/internal/plan"
+)
+
+const (
+	planFormatText = "text"
+	planFormatJSON = "json"
+)
+
+type PlanCmd struct {
+	command *cobra.Command
+	format  string
+	out     string
+	noColor bool
+}
+
+func NewPlanCmd(ctx context.Context, logger *Logger) *PlanCmd {
+	c := &PlanCmd{}
+	c.command = &cobra.Command{
+		Use:     "plan",
+		Aliases: []string{"diff"},
+		Short:   "Show the changes sync would make to Anki",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			var w io.Writer = os.Stdout
+			if c.out != "" {
+				f, err := os.Create(c.out)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			} else if c.format == planFormatJSON {
+				// The plan goes to stdout, keep it parseable.
+				logger.Level.SetLevel(zap.ErrorLevel)
+			}
+
+			ms, decks, err := loadSources(logger.Instance)
+			if err != nil {
+				return err
+			}
+
+			client := anki.NewClient(Config.AnkiURL)
+			if err := validateSources(ctx, client, logger.Instance, ms, decks); err != nil {
+				return err
+			}
+			data := &anki.Data{Models: ms, Decks: decks}
+
+			st, err := loadState()
+			if err != nil {
+				return err
+			}
+
+			p := &plan.Plan{}
+			if err := model.NewModelManager(ctx, client, true, logger.Instance, data, modelOptions()...).Plan(p); err != nil {
+				return fmt.Errorf("model plan failed: %w", err)
+			}
+			if err := deck.NewDeckManager(ctx, client, true, logger.Instance, data, append(pruneOptions(), stateOptions(st)...)...).Plan(p); err != nil {
+				return fmt.Errorf("decks plan failed: %w", err)
+			}
+
+			if c.format == planFormatJSON {
+				if err := plan.WriteJSON(w, p); err != nil {
+					return err
+				}
+			} else {
+				plan.NewRenderer(w, c.color(w)).Render(p)
+			}
+
+			if len(p.Errors) > 0 {
+				return fmt.Errorf("%d object(s) can't be planned", len(p.Errors))
+			}
+			return nil
+		},
+	}
+	return c
+}
+
+// color reports whether the output is an interactive terminal.
+func (c *PlanCmd) color(w io.Writer) bool {
+	if c.noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (c *PlanCmd) Command() *cobra.Command {
+	return c.command
+}
+
+func (c *PlanCmd) SetFlags() {
+	addSourceFlags(c.command.Flags())
+	addStrictFlag(c.command.Flags())
+	addPruneFlags(c.command.Flags())
+	addRefreshFlag(c.command.Flags())
+	addModelFlags(c.command.Flags())
+	c.command.Flags().StringVar(&c.format, "format", planFormatText, "Output format (text, json)")
+	c.command.Flags().StringVar(&c.out, "out", "", "Write the plan to a file instead of stdout")
+	c.command.Flags().BoolVar(&c.noColor, "no-color", false, "Disable colored output")
+}
+
+func (c *PlanCmd) Validate() error {
+	if Config.Models == "" {
+		return errors.New("--models or config.models must be set")
+	}
+	if Config.Decks == "" {
+		return errors.New("--decks or config.decks must be set")
+	}
+	if c.format != planFormatText && c.format != planFormatJSON {
+		return fmt.Errorf("unknown --format %q, expected %s or %s", c.format, planFormatText, planFormatJSON)
+	}
+	return validatePrune()
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/logging"
+	"github.com/spigell/anki-sync/internal/parser"
+	"github.com/spigell/anki-sync/internal/pull"
+	"github.com/spigell/anki-sync/internal/state"
+)
+
+type PullCmd struct {
+	command *cobra.Command
+	force   bool
+}
+
+func NewPullCmd(ctx context.Context, logger *logging.Logger) *PullCmd {
+	c := &PullCmd{}
+	c.command = &cobra.Command{
+		Use:   "pull",
+		Short: "Write edits made in Anki back into the deck files",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			decks, err := loadDecks(logger)
+			if err != nil {
+				return err
+			}
+			// Code blocks are highlighted with the theme of the models, if given.
+			var ms []anki.Model
+			if Config.Models != "" {
+				if ms, err = parser.LoadModels(Config.Models, Config.ModelsRecursive); err != nil {
+					return err
+				}
+			}
+			if err := parser.HighlightCode(decks, ms); err != nil {
+				return err
+			}
+
+			st, err := loadState()
+			if err != nil {
+				return err
+			}
+			if st == nil {
+				// Only --force runs without a state, see Validate.
+				logger.Warn("no state file, every difference takes the Anki value")
+				st = state.New()
+			}
+
+			client := anki.NewClient(Config.AnkiURL)
+			res, err := pull.NewPuller(ctx, client, st, Config.DryRun, logger, pull.WithForce(c.force)).Pull(decks)
+			if err != nil {
+				return err
+			}
+
+			for _, ch := range res.Changes {
+				l := logger.CloneWith(
+					zap.String("file", location(ch.Path, ch.Line)),
+					zap.String("deck", ch.Deck),
+					zap.String("note", ch.Key),
+					zap.String("field", ch.Field),
+					zap.String("before", ch.Before),
+					zap.String("after", ch.After),
+				)
+				if Config.DryRun {
+					l.DryRunLogger().Info("would pull value from Anki")
+					continue
+				}
+				l.Info("value pulled from Anki")
+			}
+
+			for _, cf := range res.Conflicts {
+				logger.Error("conflict: changed in the deck file and in Anki",
+					zap.String("file", location(cf.Path, cf.Line)),
+					zap.String("deck", cf.Deck),
+					zap.String("note", cf.Key),
+					zap.String("field", cf.Field),
+					zap.String("ours", cf.Ours),
+					zap.String("anki", cf.Anki),
+				)
+			}
+
+			for _, r := range res.Rendered {
+				logger.Warn("cannot pull rendered field, edit its source in the deck file",
+					zap.String("file", location(r.Path, r.Line)),
+					zap.String("deck", r.Deck),
+					zap.String("note", r.Key),
+					zap.String("field", r.Field),
+					zap.String("source", r.Ours),
+					zap.String("anki", r.Anki),
+				)
+			}
+
+			if !Config.DryRun && Config.StateFile != "" {
+				if err := st.Save(Config.StateFile); err != nil {
+					return fmt.Errorf("saving state: %w", err)
+				}
+			}
+
+			logger.Info("pull summary", zap.Int("pulled", len(res.Changes)), zap.Int("conflicts", len(res.Conflicts)), zap.Int("rendered", len(res.Rendered)))
+			if len(res.Conflicts) > 0 {
+				return fmt.Errorf("%d conflict(s), edit the deck files or rerun with --force to take the Anki values", len(res.Conflicts))
+			}
+			return nil
+		},
+	}
+	return c
+}
+
+func location(path string, line int) string {
+	if line > 0 {
+		return fmt.Sprintf("%s:%d", path, line)
+	}
+	return path
+}
+
+func (c *PullCmd) Command() *cobra.Command {
+	return c.command
+}
+
+func (c *PullCmd) SetFlags() {
+	addSourceFlags(c.command.Flags())
+	addStrictFlag(c.command.Flags())
+	c.command.Flags().BoolVar(&c.force, "force", false, "Take the Anki value when a note changed on both sides")
+}
+
+func (c *PullCmd) Validate() error {
+	if Config.Decks == "" {
+		return errors.New("--decks or config.decks must be set")
+	}
+	// Without the state of the last sync every difference is a conflict
+	// and nothing could be pulled.
+	if Config.StateFile == "" && !c.force {
+		return errors.New("--state-file or config.state_file must be set to the state recorded by sync, or pass --force to take every Anki value")
+	}
+	return nil
+}
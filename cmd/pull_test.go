@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/devserver"
+)
+
+func TestPull(t *testing.T) {
+	srv, err := devserver.New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	setConfig(t, AppConfig{})
+
+	dir := t.TempDir()
+	decks := filepath.Join(dir, "decks")
+	mkdir(t, decks)
+	deckFile := filepath.Join(decks, "animals.yaml")
+	writeFile(t, deckFile, "deck_name: Animals\nmodel_name: Basic\nprimary_field: Front\nnotes:\n  - fields:\n      Front: dog\n      Back: собака\n")
+	models := filepath.Join(dir, "models.yaml")
+	writeFile(t, models, basicModel)
+	stateFile := filepath.Join(dir, "state.json")
+	common := []string{"--anki-url", ts.URL, "--decks", decks}
+
+	err = execute(t, append([]string{"pull"}, common...)...)
+	if err == nil || !strings.Contains(err.Error(), "--state-file") {
+		t.Fatalf("pull with default flags error = %v, want one asking for --state-file", err)
+	}
+
+	if err := execute(t, append([]string{"sync", "--models", models, "--state-file", stateFile}, common...)...); err != nil {
+		t.Fatalf("sync error = %v", err)
+	}
+
+	// Fix a typo in Anki and pull it back.
+	client := anki.NewClient(ts.URL)
+	ids, err := client.FindNotes(context.Background(), anki.DeckSearch("Animals"))
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("FindNotes() = %v, %v, want the synced note", ids, err)
+	}
+	if err := client.UpdateNoteFields(context.Background(), ids[0], map[string]string{"Back": "пёс"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := execute(t, append([]string{"pull", "--state-file", stateFile}, common...)...); err != nil {
+		t.Fatalf("pull error = %v", err)
+	}
+	data, err := os.ReadFile(deckFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "Back: пёс") {
+		t.Errorf("deck file after pull:\n%s\nwant the value edited in Anki", data)
+	}
+}
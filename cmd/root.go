@@ -20,9 +20,19 @@ type Logger struct {
 type AppConfig struct {
 	Decks             string `mapstructure:"decks"`
 	Models            string `mapstructure:"models"`
+	ModelsRecursive   bool   `mapstructure:"models_recursive"`
 	AnkiURL           string `mapstructure:"anki_url"`
 	Recursive         bool   `mapstructure:"recursive"`
+	Strict            bool   `mapstructure:"strict"`
 	UploadParallelism int    `mapstructure:"upload_parallelism"`
+	BatchSize         int    `mapstructure:"batch_size"`
+	Prune             bool   `mapstructure:"prune"`
+	PruneMode         string `mapstructure:"prune_mode"`
+	PruneMax          int    `mapstructure:"prune_max"`
+	StateFile         string `mapstructure:"state_file"`
+	Refresh           bool   `mapstructure:"refresh"`
+	RemoveFields      bool   `mapstructure:"remove_fields"`
+	RemoveTemplates   bool   `mapstructure:"remove_templates"`
 	DryRun            bool   `mapstructure:"dry_run"`
 	LogLevel          string `mapstructure:"log_level"`
 }
@@ -45,7 +55,14 @@ type ValidatedCommand interface {
 func NewRootCmd(ctx context.Context, logger *Logger) *cobra.Command {
 	commands := []ValidatedCommand{
 		NewSyncCmd(ctx, logger.Instance),
+		NewPlanCmd(ctx, logger),
+		NewPullCmd(ctx, logger.Instance),
+		NewStateCmd(ctx, logger.Instance),
+		NewAssignIDsCmd(ctx, logger.Instance),
+		NewValidateCmd(ctx, logger),
 		NewGetCmd(ctx, logger.Instance),
+		NewExportCmd(ctx, logger.Instance),
+		NewDevServerCmd(ctx, logger.Instance),
 		NewVersionCmd(ctx, logger.Instance.Logger),
 	}
 
@@ -69,6 +86,8 @@ func NewRootCmd(ctx context.Context, logger *Logger) *cobra.Command {
 				// Otherwise, ignore missing config file
 			}
 
+			bindSharedFlags(cmd)
+
 			if err := viper.Unmarshal(Config); err != nil {
 				return err
 			}
@@ -79,7 +98,7 @@ func NewRootCmd(ctx context.Context, logger *Logger) *cobra.Command {
 					return fmt.Errorf("invalid log level %q: %w", Config.LogLevel, err)
 				}
 				logger.Level.SetLevel(lvl)
-				logger.Instance.Info("set logLevel", zap.String("level", lvl.String()))
+				logger.Instance.Debug("set logLevel", zap.String("level", lvl.String()))
 			}
 
 			if Config.DryRun {
@@ -108,11 +127,13 @@ func NewRootCmd(ctx context.Context, logger *Logger) *cobra.Command {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", DefaultConfigFile, "Config file")
 	rootCmd.PersistentFlags().String("anki-url", "http://127.0.0.1:8765", "AnkiConnect API URL")
 	rootCmd.PersistentFlags().Bool("dry-run", false, "Simulate sync actions")
+	rootCmd.PersistentFlags().String("state-file", "", "File recording the last synced state of notes, disabled when empty")
 	rootCmd.PersistentFlags().String("log-level", "info", "Log level (debug, info, warn, error)")
 
 	viper.BindPFlag("anki_url", rootCmd.PersistentFlags().Lookup("anki-url"))
 	viper.BindPFlag("log_level", rootCmd.PersistentFlags().Lookup("log-level"))
 	viper.BindPFlag("dry_run", rootCmd.PersistentFlags().Lookup("dry-run"))
+	viper.BindPFlag("state_file", rootCmd.PersistentFlags().Lookup("state-file"))
 
 	viper.SetEnvPrefix("anki_sync")
 	viper.AutomaticEnv()
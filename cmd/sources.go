@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/deck"
+	"github.com/spigell/anki-sync/internal/logging"
+	"github.com/spigell/anki-sync/internal/model"
+	"github.com/spigell/anki-sync/internal/parser"
+	"github.com/spigell/anki-sync/internal/state"
+)
+
+// sharedFlags maps config keys to the flags registered by more than one command.
+var sharedFlags = map[string]string{
+	"decks":            "decks",
+	"models":           "models",
+	"models_recursive": "models-recursive",
+	"recursive":        "recursive",
+	"prune":            "prune",
+	"prune_mode":       "prune-mode",
+	"prune_max":        "prune-max",
+	"strict":           "strict",
+	"refresh":          "refresh",
+	"remove_fields":    "remove-fields",
+	"remove_templates": "remove-templates",
+}
+
+// addSourceFlags registers the flags describing where decks and models live.
+// Several commands share them, so they are bound to the config only for the
+// command being executed, see bindSharedFlags.
+func addSourceFlags(flags *pflag.FlagSet) {
+	flags.String("decks", "", "Path to notes YAML file or directory (required)")
+	flags.String("models", "", "Path to models YAML file, directory or glob (required)")
+	flags.Bool("models-recursive", false, "Recurse into directories for models")
+	flags.Bool("recursive", false, "Recurse into directories for notes")
+}
+
+// addStrictFlag registers the flag turning unparseable deck files into a fatal error.
+func addStrictFlag(flags *pflag.FlagSet) {
+	flags.Bool("strict", false, "Abort when any deck file can't be parsed instead of skipping it")
+}
+
+// addRefreshFlag registers the flag disabling the state based skipping of notes.
+func addRefreshFlag(flags *pflag.FlagSet) {
+	flags.Bool("refresh", false, "Compare every note with Anki, including notes the state file records as unchanged")
+}
+
+// addModelFlags registers the flags allowing destructive model changes.
+func addModelFlags(flags *pflag.FlagSet) {
+	flags.Bool("remove-fields", false, "Remove model fields missing from the models file, deleting their contents in every note")
+	flags.Bool("remove-templates", false, "Remove card templates missing from the models file, deleting their cards and review history")
+}
+
+// addPruneFlags registers the flags controlling removal of notes gone from the sources.
+func addPruneFlags(flags *pflag.FlagSet) {
+	flags.Bool("prune", false, "Remove notes managed by anki-sync that are no longer in the sources")
+	flags.String("prune-mode", string(deck.PruneSuspend), "What to do with pruned notes (suspend, delete)")
+	flags.Int("prune-max", deck.DefaultPruneMax, "Maximum number of notes pruned in one run (0 for no limit)")
+}
+
+func bindSharedFlags(cmd *cobra.Command) {
+	for key, name := range sharedFlags {
+		if f := cmd.Flags().Lookup(name); f != nil {
+			viper.BindPFlag(key, f)
+		}
+	}
+}
+
+// modelOptions returns the model manager options for the configured changes.
+func modelOptions() []model.ManagerOption {
+	return []model.ManagerOption{
+		model.WithFieldRemoval(Config.RemoveFields),
+		model.WithTemplateRemoval(Config.RemoveTemplates),
+	}
+}
+
+// pruneOptions returns the deck manager options for the configured pruning.
+func pruneOptions() []deck.ManagerOption {
+	if !Config.Prune {
+		return nil
+	}
+	return []deck.ManagerOption{deck.WithPrune(deck.PruneMode(Config.PruneMode), Config.PruneMax)}
+}
+
+func validatePrune() error {
+	if !Config.Prune {
+		return nil
+	}
+	if mode := deck.PruneMode(Config.PruneMode); mode != deck.PruneDelete && mode != deck.PruneSuspend {
+		return fmt.Errorf("--prune-mode or config.prune_mode must be %q or %q", deck.PruneSuspend, deck.PruneDelete)
+	}
+	if Config.PruneMax < 0 {
+		return fmt.Errorf("--prune-max or config.prune_max must be greater or equal 0")
+	}
+	return nil
+}
+
+// loadSources parses models and decks from the configured paths.
+func loadSources(logger *logging.Logger) ([]anki.Model, []anki.Deck, error) {
+	ms, err := parser.LoadModels(Config.Models, Config.ModelsRecursive)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Pruning would remove the notes of a deck file that can't be parsed.
+	decks, err := parseDecks(logger, Config.Strict || Config.Prune)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := parser.HighlightCode(decks, ms); err != nil {
+		return nil, nil, err
+	}
+	return ms, decks, nil
+}
+
+// loadDecks parses the decks from the configured path.
+// Deck files that can't be parsed are reported and skipped, or abort the
+// run in strict mode.
+func loadDecks(logger *logging.Logger) ([]anki.Deck, error) {
+	return parseDecks(logger, Config.Strict)
+}
+
+// parseDecks is loadDecks aborting on deck files that can't be parsed when
+// strict is set.
+func parseDecks(logger *logging.Logger, strict bool) ([]anki.Deck, error) {
+	ns, err := parser.LoadDecks(Config.Decks, Config.Recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	var validDeckFiles []string
+	var invalidDeckFiles []string
+	var decks []anki.Deck
+	for _, d := range ns {
+		if !d.Parsed {
+			invalidDeckFiles = append(invalidDeckFiles, d.Path)
+			continue
+		}
+		validDeckFiles = append(validDeckFiles, d.Path)
+		decks = append(decks, d.Deck)
+	}
+
+	logger.Info("parsed decks", zap.Any("files", validDeckFiles))
+
+	if len(invalidDeckFiles) > 0 {
+		report := logger.Warn
+		if strict {
+			report = logger.Error
+		}
+		for _, d := range ns {
+			for _, e := range d.Errors {
+				report("deck file can't be parsed", zap.String("file", e.Path), zap.Int("line", e.Line), zap.String("reason", e.Reason))
+			}
+		}
+		if strict && !Config.Strict {
+			return nil, fmt.Errorf("%d deck file(s) can't be parsed, pruning is refused as it would remove their notes", len(invalidDeckFiles))
+		}
+		if strict {
+			return nil, fmt.Errorf("%d deck file(s) can't be parsed", len(invalidDeckFiles))
+		}
+		logger.Warn("invalid decks files. They are skipped", zap.Any("files", invalidDeckFiles))
+	}
+
+	return decks, nil
+}
+
+// loadState reads the configured state file. It returns nil when keeping
+// state is disabled with an empty path.
+func loadState() (*state.State, error) {
+	if Config.StateFile == "" {
+		return nil, nil
+	}
+	return state.Load(Config.StateFile)
+}
+
+// stateOptions returns the deck manager options for the loaded state.
+func stateOptions(st *state.State) []deck.ManagerOption {
+	if st == nil {
+		return nil
+	}
+	return []deck.ManagerOption{deck.WithState(st), deck.WithRefresh(Config.Refresh)}
+}
+
+// validateSources checks decks and models before anything is sent to Anki.
+// Models the decks use that are not in the models file are looked up in Anki,
+// which happens only once everything else is valid.
+func validateSources(ctx context.Context, client anki.Connector, logger *logging.Logger, ms []anki.Model, decks []anki.Deck) error {
+	errs := parser.ValidateNotes(decks, ms)
+
+	var missing []string
+	for _, err := range errs {
+		if !errors.Is(err, parser.ErrUnknownModel) {
+			return reportValidation(logger, errs)
+		}
+	}
+	for _, d := range decks {
+		if d.Model != "" && !slices.ContainsFunc(ms, func(m anki.Model) bool { return m.Name == d.Model }) && !slices.Contains(missing, d.Model) {
+			missing = append(missing, d.Model)
+		}
+	}
+	if len(missing) == 0 {
+		return reportValidation(logger, errs)
+	}
+
+	known := slices.Clone(ms)
+	for _, name := range missing {
+		m, ok, err := ankiModel(ctx, client, name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			known = append(known, m)
+		}
+	}
+	return reportValidation(logger, parser.ValidateNotes(decks, known))
+}
+
+// ankiModel loads a model that is defined in Anki only.
+func ankiModel(ctx context.Context, client anki.Connector, name string) (anki.Model, bool, error) {
+	exists, err := client.ModelExists(ctx, name)
+	if err != nil || !exists {
+		return anki.Model{}, false, err
+	}
+	fields, err := client.GetModelFieldNames(ctx, name)
+	if err != nil {
+		return anki.Model{}, false, fmt.Errorf("getting fields of model %s: %w", name, err)
+	}
+	templates, err := client.GetModelTemplates(ctx, name)
+	if err != nil {
+		return anki.Model{}, false, fmt.Errorf("getting templates of model %s: %w", name, err)
+	}
+	return anki.Model{Name: name, InOrderFields: fields, CardTemplates: templates}, true, nil
+}
+
+func reportValidation(logger *logging.Logger, errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	for _, err := range errs {
+		logger.Error("invalid source", zap.Error(err))
+	}
+	return fmt.Errorf("%d validation error(s) in sources", len(errs))
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/spigell/anki-sync/internal/logging"
+	"github.com/spigell/anki-sync/internal/state"
+)
+
+const (
+	stateFormatText = "text"
+	stateFormatJSON = "json"
+)
+
+type StateCmd struct {
+	command *cobra.Command
+	deck    string
+	format  string
+}
+
+func NewStateCmd(_ context.Context, logger *logging.Logger) *StateCmd {
+	c := &StateCmd{}
+	c.command = &cobra.Command{
+		Use:   "state",
+		Short: "Show the notes recorded in the state file",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			if _, err := os.Stat(Config.StateFile); errors.Is(err, os.ErrNotExist) {
+				logger.Warn("state file doesn't exist yet, sync creates it", zap.String("file", Config.StateFile))
+			}
+
+			st, err := state.Load(Config.StateFile)
+			if err != nil {
+				return err
+			}
+
+			notes := make([]state.Note, 0)
+			for _, n := range st.Notes() {
+				if c.deck == "" || n.Deck == c.deck {
+					notes = append(notes, n)
+				}
+			}
+
+			if c.format == stateFormatJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(notes)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "DECK\tNOTE ID\tHASH\tSOURCE\tKEY")
+			for _, n := range notes {
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%q\n", n.Deck, n.NoteID, n.Hash, n.Source, n.Key)
+			}
+			return w.Flush()
+		},
+	}
+	return c
+}
+
+func (c *StateCmd) Command() *cobra.Command {
+	return c.command
+}
+
+func (c *StateCmd) SetFlags() {
+	c.command.Flags().StringVar(&c.deck, "deck", "", "Show only the notes of this deck")
+	c.command.Flags().StringVar(&c.format, "format", stateFormatText, "Output format (text, json)")
+}
+
+func (c *StateCmd) Validate() error {
+	if Config.StateFile == "" {
+		return errors.New("--state-file or config.state_file must be set")
+	}
+	if c.format != stateFormatText && c.format != stateFormatJSON {
+		return fmt.Errorf("unknown --format %q, expected %s or %s", c.format, stateFormatText, stateFormatJSON)
+	}
+	return nil
+}
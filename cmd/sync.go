@@ -8,10 +8,8 @@ import (
 	"github.com/spigell/anki-sync/internal/anki"
 	"github.com/spigell/anki-sync/internal/deck"
 	"github.com/spigell/anki-sync/internal/logging"
-	"go.uber.org/zap"
 
 	"github.com/spigell/anki-sync/internal/model"
-	"github.com/spigell/anki-sync/internal/parser"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -27,47 +25,47 @@ func NewSyncCmd(ctx context.Context, logger *logging.Logger) *SyncCmd {
 			Use:   "sync",
 			Short: "Sync notes, models, and decks with Anki",
 			RunE: func(_ *cobra.Command, _ []string) error {
-				ms, err := parser.LoadModels(Config.Models)
+				ms, decks, err := loadSources(logger)
 				if err != nil {
 					return err
 				}
 
-				ns, err := parser.LoadDecks(Config.Decks, Config.Recursive)
-				if err != nil {
-					return err
-				}
-
-				var validDeckFiles []string
-				var invalidDeckFiles []string
-				var decks []anki.Deck
-				for _, d := range ns {
-					if !d.Parsed {
-						invalidDeckFiles = append(invalidDeckFiles, d.Path)
-						continue
-					}
-					validDeckFiles = append(validDeckFiles, d.Path)
-					decks = append(decks, d.Deck)
-				}
-
-				logger.Info("parsed decks", zap.Any("files", validDeckFiles))
+				client := anki.NewClient(Config.AnkiURL)
 
-				if len(invalidDeckFiles) > 0 {
-					logger.Warn("invalid decks files. They are skipped", zap.Any("files", invalidDeckFiles))
+				if err := validateSources(ctx, client, logger, ms, decks); err != nil {
+					return err
 				}
 
-				client := anki.NewClient(Config.AnkiURL)
-
 				if err := model.NewModelManager(ctx, client, Config.DryRun, logger, &anki.Data{
 					Models: ms,
-				}).Sync(); err != nil {
+				}, modelOptions()...).Sync(); err != nil {
 					return fmt.Errorf("model sync failed: %w", err)
 				}
 
-				if err := deck.NewDeckManager(ctx, client, Config.DryRun, logger, &anki.Data{
+				st, err := loadState()
+				if err != nil {
+					return err
+				}
+
+				opts := append([]deck.ManagerOption{
+					deck.WithNoteUploadParallelism(Config.UploadParallelism),
+					deck.WithBatchSize(Config.BatchSize),
+				}, pruneOptions()...)
+				opts = append(opts, stateOptions(st)...)
+
+				syncErr := deck.NewDeckManager(ctx, client, Config.DryRun, logger, &anki.Data{
 					Models: ms,
 					Decks:  decks,
-				}, deck.WithNoteUploadParallelism(Config.UploadParallelism)).Sync(); err != nil {
-					return fmt.Errorf("decks sync failed: %w", err)
+				}, opts...).Sync()
+
+				// Notes synced before a failure are recorded as well.
+				if st != nil && !Config.DryRun {
+					if err := st.Save(Config.StateFile); err != nil {
+						return fmt.Errorf("saving state: %w", err)
+					}
+				}
+				if syncErr != nil {
+					return fmt.Errorf("decks sync failed: %w", syncErr)
 				}
 
 				logger.Info("note sync done")
@@ -82,17 +80,16 @@ func (c *SyncCmd) Command() *cobra.Command {
 }
 
 func (c *SyncCmd) SetFlags() {
-	flags := c.command.PersistentFlags()
-
-	c.command.PersistentFlags().String("decks", "", "Path to notes YAML file or directory (required)")
-	c.command.PersistentFlags().String("models", "", "Path to models YAML file (required)")
-	c.command.PersistentFlags().Bool("recursive", false, "Recurse into directories for notes")
+	addSourceFlags(c.command.PersistentFlags())
+	addStrictFlag(c.command.PersistentFlags())
+	addPruneFlags(c.command.PersistentFlags())
+	addRefreshFlag(c.command.PersistentFlags())
+	addModelFlags(c.command.PersistentFlags())
 	c.command.PersistentFlags().Int("upload-parallelism", runtime.NumCPU(), "Concurrent note uploads per file")
+	c.command.PersistentFlags().Int("batch-size", deck.DefaultBatchSize, "Notes sent per AnkiConnect request")
 
-	viper.BindPFlag("models", c.command.PersistentFlags().Lookup("models"))
-	viper.BindPFlag("decks", flags.Lookup("decks"))
-	viper.BindPFlag("recursive", c.command.PersistentFlags().Lookup("recursive"))
 	viper.BindPFlag("upload_parallelism", c.command.PersistentFlags().Lookup("upload-parallelism"))
+	viper.BindPFlag("batch_size", c.command.PersistentFlags().Lookup("batch-size"))
 }
 
 func (c *SyncCmd) Validate() error {
@@ -106,5 +103,9 @@ func (c *SyncCmd) Validate() error {
 	if Config.UploadParallelism < 1 {
 		return fmt.Errorf("--upload-parallelism or config.upload-parallelism must be greater or equal 1")
 	}
-	return nil
+
+	if Config.BatchSize < 1 {
+		return fmt.Errorf("--batch-size or config.batch_size must be greater or equal 1")
+	}
+	return validatePrune()
 }
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spigell/anki-sync/internal/devserver"
+)
+
+// A deck split across files loses no notes to pruning when one file breaks.
+func TestSyncPruneSkippedDeckFile(t *testing.T) {
+	srv, err := devserver.New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	setConfig(t, AppConfig{})
+
+	dir := t.TempDir()
+	decks := filepath.Join(dir, "decks")
+	models := filepath.Join(dir, "models.yaml")
+	writeFile(t, models, basicModel)
+	mkdir(t, decks)
+	const header = "deck_name: Animals\nmodel_name: Basic\nprimary_field: Front\n"
+	writeFile(t, filepath.Join(decks, "cats.yaml"), header+"notes:\n  - fields: {Front: cat, Back: кошка}\n")
+	dogs := filepath.Join(decks, "dogs.yaml")
+	writeFile(t, dogs, header+"notes:\n  - fields: {Front: dog, Back: собака}\n")
+	args := []string{"sync", "--anki-url", ts.URL, "--decks", decks, "--models", models, "--prune", "--prune-mode", "delete"}
+
+	if err := execute(t, args...); err != nil {
+		t.Fatalf("sync error = %v", err)
+	}
+	if got := len(srv.Snapshot().Notes); got != 2 {
+		t.Fatalf("got %d notes after the first sync, want 2", got)
+	}
+
+	writeFile(t, dogs, header+"notes:\n  - fields: {Front: dog, Back: собака}\n  unknown: true\n")
+	err = execute(t, args...)
+	if err == nil || !strings.Contains(err.Error(), "pruning is refused") {
+		t.Errorf("sync with a broken deck file error = %v, want pruning refused", err)
+	}
+	if got := len(srv.Snapshot().Notes); got != 2 {
+		t.Errorf("got %d notes after the refused sync, want 2", got)
+	}
+}
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/parser"
+)
+
+const (
+	validateFormatText   = "text"
+	validateFormatJSON   = "json"
+	validateFormatGitHub = "github"
+
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// finding is a single problem reported by `validate`.
+type finding struct {
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+type ValidateCmd struct {
+	command      *cobra.Command
+	format       string
+	out          string
+	allowUnknown bool
+}
+
+func NewValidateCmd(_ context.Context, logger *Logger) *ValidateCmd {
+	c := &ValidateCmd{}
+	c.command = &cobra.Command{
+		Use:   "validate",
+		Short: "Check decks and models without connecting to Anki",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			var w io.Writer = os.Stdout
+			if c.out != "" {
+				f, err := os.Create(c.out)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			} else if c.format != validateFormatText {
+				// Findings go to stdout, keep them parseable.
+				logger.Level.SetLevel(zap.ErrorLevel)
+			}
+
+			findings, err := c.findings()
+			if err != nil {
+				return err
+			}
+
+			if err := c.write(w, findings); err != nil {
+				return err
+			}
+
+			errCount := 0
+			for _, f := range findings {
+				if f.Severity == severityError {
+					errCount++
+				}
+			}
+			if errCount > 0 {
+				return fmt.Errorf("%d problem(s) found", errCount)
+			}
+
+			logger.Instance.Info("sources are valid", zap.Int("warnings", len(findings)))
+			return nil
+		},
+	}
+	return c
+}
+
+// findings loads the sources and runs every validation rule on them. Parse
+// errors of the models and of the decks are both reported; decks are only
+// checked against the models once the models parse.
+func (c *ValidateCmd) findings() ([]finding, error) {
+	var findings []finding
+
+	ms, err := parser.LoadModels(Config.Models, Config.ModelsRecursive)
+	modelsParsed := err == nil
+	if err != nil {
+		var perr *parser.ParseError
+		if !errors.As(err, &perr) {
+			return nil, err
+		}
+		for _, e := range unjoin(errors.Unwrap(err)) {
+			if errors.As(e, &perr) {
+				findings = append(findings, finding{File: perr.Path, Line: perr.Line, Severity: severityError, Message: perr.Reason})
+			}
+		}
+	}
+
+	parsed, err := parser.LoadDecks(Config.Decks, Config.Recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	var decks []anki.Deck
+	for _, d := range parsed {
+		if !d.Parsed {
+			for _, e := range d.Errors {
+				findings = append(findings, finding{File: e.Path, Line: e.Line, Severity: severityError, Message: e.Reason})
+			}
+			continue
+		}
+		decks = append(decks, d.Deck)
+	}
+	if !modelsParsed {
+		return findings, nil
+	}
+
+	for _, err := range parser.ValidateNotes(decks, ms) {
+		f := finding{Severity: severityError, Message: err.Error()}
+		var verr *parser.ValidationError
+		if errors.As(err, &verr) {
+			f.File, f.Line, f.Message = verr.Path, verr.Line, verr.Err.Error()
+		}
+		if c.allowUnknown && errors.Is(err, parser.ErrUnknownModel) {
+			f.Severity = severityWarning
+		}
+		findings = append(findings, f)
+	}
+	return findings, nil
+}
+
+// unjoin returns the errors combined with errors.Join, or err itself.
+func unjoin(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+func (c *ValidateCmd) write(w io.Writer, findings []finding) error {
+	switch c.format {
+	case validateFormatJSON:
+		if findings == nil {
+			findings = []finding{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(findings)
+	case validateFormatGitHub:
+		for _, f := range findings {
+			props := "file=" + escapeGitHubProperty(f.File)
+			if f.Line > 0 {
+				props += fmt.Sprintf(",line=%d", f.Line)
+			}
+			fmt.Fprintf(w, "::%s %s::%s\n", f.Severity, props, escapeGitHubData(f.Message))
+		}
+	default:
+		for _, f := range findings {
+			location := f.File
+			if f.Line > 0 {
+				location = fmt.Sprintf("%s:%d", f.File, f.Line)
+			}
+			if f.Severity == severityWarning {
+				fmt.Fprintf(w, "%s: warning: %s\n", location, f.Message)
+				continue
+			}
+			fmt.Fprintf(w, "%s: %s\n", location, f.Message)
+		}
+	}
+	return nil
+}
+
+// escapeGitHubData escapes a workflow command message.
+func escapeGitHubData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeGitHubProperty escapes a workflow command property value.
+func escapeGitHubProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+func (c *ValidateCmd) Command() *cobra.Command {
+	return c.command
+}
+
+func (c *ValidateCmd) SetFlags() {
+	addSourceFlags(c.command.Flags())
+	c.command.Flags().StringVar(&c.format, "format", validateFormatText, "Output format (text, json, github)")
+	c.command.Flags().StringVar(&c.out, "out", "", "Write the findings to a file instead of stdout")
+	c.command.Flags().BoolVar(&c.allowUnknown, "allow-unknown-models", false, "Report decks using models missing from the models file as warnings, e.g. built-in Anki models")
+}
+
+func (c *ValidateCmd) Validate() error {
+	if Config.Models == "" {
+		return errors.New("--models or config.models must be set")
+	}
+	if Config.Decks == "" {
+		return errors.New("--decks or config.decks must be set")
+	}
+	switch c.format {
+	case validateFormatText, validateFormatJSON, validateFormatGitHub:
+		return nil
+	default:
+		return fmt.Errorf("unknown --format %q, expected %s, %s or %s", c.format, validateFormatText, validateFormatJSON, validateFormatGitHub)
+	}
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A broken models file doesn't hide the problems of the deck files.
+func TestValidateModelsAndDecks(t *testing.T) {
+	setConfig(t, AppConfig{})
+
+	dir := t.TempDir()
+	decks := filepath.Join(dir, "decks")
+	models := filepath.Join(dir, "models.yaml")
+	out := filepath.Join(dir, "findings.json")
+	writeFile(t, models, basicModel+"unknown: true\n")
+	mkdir(t, decks)
+	writeFile(t, filepath.Join(decks, "cats.yaml"), "deck_name: Animals\nmodel_name: Basic\nprimary_field: Front\nnotes: {}\n")
+
+	err := execute(t, "validate", "--decks", decks, "--models", models, "--format", "json", "--out", out)
+	if err == nil || !strings.Contains(err.Error(), "2 problem(s) found") {
+		t.Errorf("validate error = %v, want 2 problems", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var findings []finding
+	if err := json.Unmarshal(data, &findings); err != nil {
+		t.Fatalf("findings %s: %v", data, err)
+	}
+	files := make(map[string]bool)
+	for _, f := range findings {
+		files[filepath.Base(f.File)] = true
+	}
+	if !files["models.yaml"] || !files["cats.yaml"] {
+		t.Errorf("findings = %+v, want problems in models.yaml and cats.yaml", findings)
+	}
+}
@@ -0,0 +1,84 @@
+// Package ankitest provides an in-memory AnkiConnect implementation for tests.
+//
+// The devserver emulator is the shared test double: the fake runs it
+// in-process, so unit tests and the integration tests against
+// `anki-sync dev-server` exercise the same AnkiConnect behaviour.
+package ankitest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+
+	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/devserver"
+)
+
+// Note is a note stored in the fake collection.
+type Note = devserver.Note
+
+// Fake simulates an Anki collection behind AnkiConnect.
+// It is a regular anki.Client wired to the devserver emulator in-process,
+// so requests never touch the network while errors carry the same messages
+// AnkiConnect returns.
+type Fake struct {
+	*anki.Client
+	srv *devserver.Server
+}
+
+var _ anki.Connector = (*Fake)(nil)
+
+// NewFake returns an empty collection with the "Default" deck and the stock
+// note types, like a fresh Anki profile.
+func NewFake() *Fake {
+	// An in-memory server never fails to load its state.
+	srv, _ := devserver.New("")
+
+	f := &Fake{srv: srv}
+	f.Client = anki.NewClient("http://ankitest.invalid", anki.WithHTTPClient(&http.Client{
+		Transport: handlerTransport{srv},
+	}))
+	return f
+}
+
+// FailOn makes every call of the given AnkiConnect action (e.g. "addNote") return err.
+// Passing a nil error clears the failure.
+func (f *Fake) FailOn(action string, err error) {
+	f.srv.FailOn(action, err)
+}
+
+// Decks returns the names of all decks in the collection.
+func (f *Fake) Decks() []string {
+	decks := f.srv.Snapshot().Decks
+	sort.Strings(decks)
+	return decks
+}
+
+// Model returns a stored model by name.
+func (f *Fake) Model(name string) (anki.Model, bool) {
+	m, ok := f.srv.Snapshot().Models[name]
+	return m, ok
+}
+
+// Notes returns copies of all stored notes ordered by ID.
+func (f *Fake) Notes() []Note {
+	state := f.srv.Snapshot()
+
+	notes := make([]Note, 0, len(state.Notes))
+	for _, n := range state.Notes {
+		notes = append(notes, *n)
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].ID < notes[j].ID })
+	return notes
+}
+
+// handlerTransport serves requests with an http.Handler without a network round-trip.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, req)
+	return rec.Result(), nil
+}
@@ -0,0 +1,100 @@
+package ankitest_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/anki/ankitest"
+	"github.com/spigell/anki-sync/internal/deck"
+	"github.com/spigell/anki-sync/internal/logging"
+	"github.com/spigell/anki-sync/internal/model"
+	"go.uber.org/zap"
+)
+
+func TestNewFake(t *testing.T) {
+	fake := ankitest.NewFake()
+
+	if got := fake.Decks(); !slices.Equal(got, []string{"Default"}) {
+		t.Errorf("Decks() = %v, want [Default]", got)
+	}
+	tests := []struct {
+		model     string
+		wantField []string
+		wantCloze bool
+	}{
+		{model: "Basic", wantField: []string{"Front", "Back"}},
+		{model: "Cloze", wantField: []string{"Text", "Back Extra"}, wantCloze: true},
+	}
+	for _, tt := range tests {
+		m, ok := fake.Model(tt.model)
+		if !ok {
+			t.Errorf("Model(%q) is missing", tt.model)
+			continue
+		}
+		if !slices.Equal(m.InOrderFields, tt.wantField) || m.IsCloze != tt.wantCloze {
+			t.Errorf("Model(%q) = %+v, want fields %v, cloze %v", tt.model, m, tt.wantField, tt.wantCloze)
+		}
+	}
+	if got := fake.Notes(); len(got) != 0 {
+		t.Errorf("Notes() = %v, want none", got)
+	}
+}
+
+func TestFailOn(t *testing.T) {
+	ctx := context.Background()
+	fake := ankitest.NewFake()
+
+	fake.FailOn("deckNames", errors.New("collection is not available"))
+	if _, err := fake.DeckExists(ctx, "Default"); err == nil || !strings.Contains(err.Error(), "collection is not available") {
+		t.Errorf("DeckExists() error = %v, want the injected one", err)
+	}
+
+	fake.FailOn("deckNames", nil)
+	if ok, err := fake.DeckExists(ctx, "Default"); err != nil || !ok {
+		t.Errorf("DeckExists() = %v, %v after clearing the failure", ok, err)
+	}
+}
+
+// TestManagers runs the sync managers against the fake through anki.Connector.
+func TestManagers(t *testing.T) {
+	ctx := context.Background()
+	logger := &logging.Logger{Logger: zap.NewNop()}
+	fake := ankitest.NewFake()
+
+	data := &anki.Data{
+		Models: []anki.Model{{
+			Name:          "Vocabulary",
+			InOrderFields: []string{"Word", "Meaning"},
+			CardTemplates: []anki.CardTemplate{{Name: "Card 1", Front: "{{Word}}", Back: "{{Meaning}}"}},
+		}},
+		Decks: []anki.Deck{{
+			Deck: "English", Model: "Vocabulary", PrimaryField: "Word",
+			Notes: []anki.Note{
+				{Fields: map[string]string{"Word": "cat", "Meaning": "кошка"}},
+				{Fields: map[string]string{"Word": "dog", "Meaning": "собака"}},
+			},
+		}},
+	}
+
+	if err := model.NewModelManager(ctx, fake, false, logger, data).Sync(); err != nil {
+		t.Fatalf("model Sync() error = %v", err)
+	}
+	if _, ok := fake.Model("Vocabulary"); !ok {
+		t.Error("model Vocabulary was not created")
+	}
+
+	if err := deck.NewDeckManager(ctx, fake, false, logger, data, deck.WithNoteUploadParallelism(1)).Sync(); err != nil {
+		t.Fatalf("deck Sync() error = %v", err)
+	}
+	if !slices.Contains(fake.Decks(), "English") {
+		t.Errorf("deck English was not created, decks: %v", fake.Decks())
+	}
+	notes := fake.Notes()
+	if len(notes) != 2 || notes[0].Deck != "English" || notes[0].Model != "Vocabulary" || notes[0].Fields["Word"] != "cat" {
+		t.Errorf("Notes() = %+v, want cat and dog in English", notes)
+	}
+}
@@ -3,6 +3,7 @@ package anki
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,19 +18,34 @@ type Client struct {
 	client  *http.Client
 }
 
-func NewClient(baseURL string) *Client {
-	return &Client{
+type ClientOption func(*Client)
+
+func NewClient(baseURL string, opts ...ClientOption) *Client {
+	c := &Client{
 		baseURL: baseURL,
 		client: &http.Client{
 			Transport: &http.Transport{
-				// AnkiConnect sometimes drop connections from their pool.
-				// Crate a new connection all the time.
-				// It is ok for the tool.
+				// AnkiConnect closes idle connections without notice and a
+				// request sent over such a connection fails. Notes travel in
+				// `multi` batches, so a connection per request costs little.
 				DisableKeepAlives: true,
 			},
 			Timeout: 10 * time.Second,
 		},
 	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// WithHTTPClient replaces the HTTP client used to reach AnkiConnect.
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(c *Client) {
+		c.client = client
+	}
 }
 
 type request struct {
@@ -109,6 +125,100 @@ func (c *Client) UpdateModelStyling(ctx context.Context, name string, css string
 	}, nil)
 }
 
+// ModelFieldAdd adds a field to a model at the given position.
+func (c *Client) ModelFieldAdd(ctx context.Context, model, field string, index int) error {
+	return c.do(ctx, request{
+		Action:  "modelFieldAdd",
+		Version: 6,
+		Params: map[string]any{
+			"modelName": model,
+			"fieldName": field,
+			"index":     index,
+		},
+	}, nil)
+}
+
+// ModelFieldRename renames a field of a model, keeping the note contents.
+func (c *Client) ModelFieldRename(ctx context.Context, model, oldName, newName string) error {
+	return c.do(ctx, request{
+		Action:  "modelFieldRename",
+		Version: 6,
+		Params: map[string]any{
+			"modelName":    model,
+			"oldFieldName": oldName,
+			"newFieldName": newName,
+		},
+	}, nil)
+}
+
+// ModelFieldRemove removes a field, and its contents in every note, from a model.
+func (c *Client) ModelFieldRemove(ctx context.Context, model, field string) error {
+	return c.do(ctx, request{
+		Action:  "modelFieldRemove",
+		Version: 6,
+		Params: map[string]any{
+			"modelName": model,
+			"fieldName": field,
+		},
+	}, nil)
+}
+
+// ModelFieldReposition moves a field of a model to the given position.
+func (c *Client) ModelFieldReposition(ctx context.Context, model, field string, index int) error {
+	return c.do(ctx, request{
+		Action:  "modelFieldReposition",
+		Version: 6,
+		Params: map[string]any{
+			"modelName": model,
+			"fieldName": field,
+			"index":     index,
+		},
+	}, nil)
+}
+
+// ModelTemplateAdd adds a card template to a model, which creates its cards
+// for the existing notes.
+func (c *Client) ModelTemplateAdd(ctx context.Context, model string, t CardTemplate) error {
+	return c.do(ctx, request{
+		Action:  "modelTemplateAdd",
+		Version: 6,
+		Params: map[string]any{
+			"modelName": model,
+			"template": map[string]string{
+				"Name":  t.Name,
+				"Front": t.Front,
+				"Back":  t.Back,
+			},
+		},
+	}, nil)
+}
+
+// ModelTemplateRename renames a card template of a model, keeping its cards.
+func (c *Client) ModelTemplateRename(ctx context.Context, model, oldName, newName string) error {
+	return c.do(ctx, request{
+		Action:  "modelTemplateRename",
+		Version: 6,
+		Params: map[string]any{
+			"modelName":       model,
+			"oldTemplateName": oldName,
+			"newTemplateName": newName,
+		},
+	}, nil)
+}
+
+// ModelTemplateRemove removes a card template from a model together with its
+// cards and their review history.
+func (c *Client) ModelTemplateRemove(ctx context.Context, model, name string) error {
+	return c.do(ctx, request{
+		Action:  "modelTemplateRemove",
+		Version: 6,
+		Params: map[string]any{
+			"modelName":    model,
+			"templateName": name,
+		},
+	}, nil)
+}
+
 func (c *Client) GetModelTemplates(ctx context.Context, name string) ([]CardTemplate, error) {
 	var result map[string]struct {
 		Front string `json:"Front"`
@@ -172,11 +282,7 @@ func (c *Client) GetModelFieldNames(ctx context.Context, name string) ([]string,
 }
 
 func (c *Client) DeckExists(ctx context.Context, name string) (bool, error) {
-	var result []string
-	err := c.do(ctx, request{
-		Action:  "deckNames",
-		Version: 6,
-	}, &result)
+	result, err := c.DeckNames(ctx)
 	if err != nil {
 		return false, err
 	}
@@ -187,6 +293,18 @@ func (c *Client) DeckExists(ctx context.Context, name string) (bool, error) {
 	return false, nil
 }
 
+func (c *Client) DeckNames(ctx context.Context) ([]string, error) {
+	var result []string
+	err := c.do(ctx, request{
+		Action:  "deckNames",
+		Version: 6,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func (c *Client) CreateDeck(ctx context.Context, name string) error {
 	return c.do(ctx, request{
 		Action:  "createDeck",
@@ -198,56 +316,293 @@ func (c *Client) CreateDeck(ctx context.Context, name string) error {
 }
 
 func (c *Client) AddNote(ctx context.Context, deck, model string, n Note) error {
-	note := map[string]any{
-		"deckName":  deck,
-		"modelName": model,
-		"fields":    n.Fields,
-		"tags":      n.Tags,
-		"options": map[string]any{
-			"allowDuplicate": false,
+	return c.do(ctx, addNoteRequest(deck, model, n), nil)
+}
+
+// NoteExists looks up a single note, see NotesExist.
+func (c *Client) NoteExists(ctx context.Context, deck string, search NoteSearch) (bool, int64, error) {
+	lookups, err := c.NotesExist(ctx, deck, []NoteSearch{search})
+	if err != nil {
+		return false, 0, err
+	}
+	return lookups[0].Exists, lookups[0].ID, lookups[0].Err
+}
+
+// NotesExist resolves several lookups of the same deck, without its subdecks, with
+// a single `multi` call. As Anki searches ignore case, the candidates are
+// then fetched with one `notesInfo` call and compared with the exact values.
+// Lookup errors are reported per item and never abort the whole batch.
+func (c *Client) NotesExist(ctx context.Context, deck string, searches []NoteSearch) ([]NoteLookup, error) {
+	reqs := make([]request, len(searches))
+	ids := make([][]int64, len(searches))
+	results := make([]any, len(searches))
+	for i, s := range searches {
+		reqs[i] = findNotesRequest(Search(OnlyDeckSearch(deck), s.Term()))
+		results[i] = &ids[i]
+	}
+
+	errs, err := c.multi(ctx, reqs, results)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []int64
+	seen := make(map[int64]bool)
+	for i := range searches {
+		for _, id := range ids[i] {
+			if errs[i] == nil && !seen[id] {
+				seen[id] = true
+				candidates = append(candidates, id)
+			}
+		}
+	}
+
+	byID := make(map[int64]NoteInfo, len(candidates))
+	if len(candidates) > 0 {
+		infos, err := c.NotesInfo(ctx, candidates)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			byID[info.NoteID] = info
+		}
+	}
+
+	lookups := make([]NoteLookup, len(searches))
+	for i, s := range searches {
+		if errs[i] != nil {
+			lookups[i].Err = errs[i]
+			continue
+		}
+		var matches []int64
+		for _, id := range ids[i] {
+			if info, ok := byID[id]; ok && s.Matches(info) {
+				matches = append(matches, id)
+			}
+		}
+		lookups[i].Exists, lookups[i].ID, lookups[i].Err = lookupResult(s, matches)
+	}
+
+	return lookups, nil
+}
+
+func (c *Client) FindNotes(ctx context.Context, query string) ([]int64, error) {
+	var ids []int64
+	if err := c.do(ctx, findNotesRequest(query), &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (c *Client) NotesInfo(ctx context.Context, ids []int64) ([]NoteInfo, error) {
+	var result []NoteInfo
+	err := c.do(ctx, request{
+		Action:  "notesInfo",
+		Version: 6,
+		Params: map[string]any{
+			"notes": ids,
 		},
+	}, &result)
+	if err != nil {
+		return nil, err
 	}
+
+	return result, nil
+}
+
+// AddNotes creates notes with a single `multi` call.
+// The result for every note carries either the new note ID or its error.
+func (c *Client) AddNotes(ctx context.Context, deck, model string, notes []Note) ([]NoteResult, error) {
+	reqs := make([]request, len(notes))
+	results := make([]any, len(notes))
+	noteResults := make([]NoteResult, len(notes))
+	for i, n := range notes {
+		reqs[i] = addNoteRequest(deck, model, n)
+		results[i] = &noteResults[i].ID
+	}
+
+	errs, err := c.multi(ctx, reqs, results)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range noteResults {
+		noteResults[i].Err = errs[i]
+	}
+
+	return noteResults, nil
+}
+
+// UpdateNotes replaces fields and tags of existing notes with a single `multi` call.
+// Nil Fields or Tags of an update are left untouched.
+// The returned slice holds the error of every update, nil on success.
+func (c *Client) UpdateNotes(ctx context.Context, updates []NoteUpdate) ([]error, error) {
+	type owner struct {
+		update int
+		what   string
+	}
+
+	var (
+		reqs   []request
+		owners []owner
+	)
+	for i, u := range updates {
+		if u.Fields != nil {
+			reqs = append(reqs, updateNoteFieldsRequest(u.ID, u.Fields))
+			owners = append(owners, owner{i, "fields"})
+		}
+		if u.Tags != nil {
+			reqs = append(reqs, updateNoteTagsRequest(u.ID, u.Tags))
+			owners = append(owners, owner{i, "tags"})
+		}
+	}
+
+	errs, err := c.multi(ctx, reqs, make([]any, len(reqs)))
+	if err != nil {
+		return nil, err
+	}
+
+	updateErrs := make([]error, len(updates))
+	for j, err := range errs {
+		if err == nil {
+			continue
+		}
+		o := owners[j]
+		updateErrs[o.update] = errors.Join(updateErrs[o.update], fmt.Errorf("error while updating %s of note: %w", o.what, err))
+	}
+
+	return updateErrs, nil
+}
+
+func (c *Client) UpdateNoteFields(ctx context.Context, noteID int64, fields map[string]string) error {
+	return c.do(ctx, updateNoteFieldsRequest(noteID, fields), nil)
+}
+
+func (c *Client) UpdateNoteTags(ctx context.Context, noteID int64, tags []string) error {
+	return c.do(ctx, updateNoteTagsRequest(noteID, tags), nil)
+}
+
+func (c *Client) DeleteNotes(ctx context.Context, ids []int64) error {
 	return c.do(ctx, request{
-		Action:  "addNote",
+		Action:  "deleteNotes",
 		Version: 6,
-		Params:  map[string]any{"note": note},
+		Params: map[string]any{
+			"notes": ids,
+		},
 	}, nil)
 }
 
-func (c *Client) NoteExists(ctx context.Context, deck, searchField string) (bool, int64, error) {
-	ids := make([]int64, 1)
-	exists := false
+func (c *Client) SuspendCards(ctx context.Context, cardIDs []int64) error {
+	return c.do(ctx, request{
+		Action:  "suspend",
+		Version: 6,
+		Params: map[string]any{
+			"cards": cardIDs,
+		},
+	}, nil)
+}
 
-	query := fmt.Sprintf(`deck:%s "%s"`, deck, searchField)
+// StoreMediaFile uploads a file to the media folder and returns the name it is stored under.
+func (c *Client) StoreMediaFile(ctx context.Context, name string, data []byte) (string, error) {
+	var stored string
+	err := c.do(ctx, request{
+		Action:  "storeMediaFile",
+		Version: 6,
+		Params: map[string]any{
+			"filename": name,
+			"data":     base64.StdEncoding.EncodeToString(data),
+		},
+	}, &stored)
+	if err != nil {
+		return "", err
+	}
+	return stored, nil
+}
 
+// RetrieveMediaFile downloads a file from the media folder.
+// The boolean is false if there is no such file.
+func (c *Client) RetrieveMediaFile(ctx context.Context, name string) ([]byte, bool, error) {
+	var result json.RawMessage
 	err := c.do(ctx, request{
-		Action:  "findNotes",
+		Action:  "retrieveMediaFile",
 		Version: 6,
 		Params: map[string]any{
-			"query": query,
+			"filename": name,
 		},
-	}, &ids)
+	}, &result)
 	if err != nil {
-		return false, 0, err
+		return nil, false, err
 	}
 
-	if len(ids) == 1 {
-		exists = true
+	// AnkiConnect answers `false` for missing files.
+	var encoded string
+	if err := json.Unmarshal(result, &encoded); err != nil {
+		return nil, false, nil
 	}
 
-	if len(ids) == 0 {
-		ids = append(ids, 0)
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, false, fmt.Errorf("decode media file %s: %w", name, err)
 	}
+	return data, true, nil
+}
 
-	if len(ids) > 1 {
-		return false, 0, errors.New("more than 1 ids received")
+// GetMediaFilesNames lists media files matching a glob pattern.
+func (c *Client) GetMediaFilesNames(ctx context.Context, pattern string) ([]string, error) {
+	var names []string
+	err := c.do(ctx, request{
+		Action:  "getMediaFilesNames",
+		Version: 6,
+		Params: map[string]any{
+			"pattern": pattern,
+		},
+	}, &names)
+	if err != nil {
+		return nil, err
 	}
+	return names, nil
+}
 
-	return exists, ids[0], nil
+func lookupResult(s NoteSearch, ids []int64) (bool, int64, error) {
+	switch len(ids) {
+	case 0:
+		return false, 0, nil
+	case 1:
+		return true, ids[0], nil
+	default:
+		return false, 0, fmt.Errorf("%d notes match %s", len(ids), s)
+	}
 }
 
-func (c *Client) UpdateNoteFields(ctx context.Context, noteID int64, fields map[string]string) error {
-	return c.do(ctx, request{
+func findNotesRequest(query string) request {
+	return request{
+		Action:  "findNotes",
+		Version: 6,
+		Params: map[string]any{
+			"query": query,
+		},
+	}
+}
+
+func addNoteRequest(deck, model string, n Note) request {
+	note := map[string]any{
+		"deckName":  deck,
+		"modelName": model,
+		"fields":    n.Fields,
+		"tags":      n.Tags,
+		"options": map[string]any{
+			"allowDuplicate": false,
+		},
+	}
+	return request{
+		Action:  "addNote",
+		Version: 6,
+		Params:  map[string]any{"note": note},
+	}
+}
+
+func updateNoteFieldsRequest(noteID int64, fields map[string]string) request {
+	return request{
 		Action:  "updateNoteFields",
 		Version: 6,
 		Params: map[string]any{
@@ -256,18 +611,56 @@ func (c *Client) UpdateNoteFields(ctx context.Context, noteID int64, fields map[
 				"fields": fields,
 			},
 		},
-	}, nil)
+	}
 }
 
-func (c *Client) UpdateNoteTags(ctx context.Context, noteID int64, tags []string) error {
-	return c.do(ctx, request{
+func updateNoteTagsRequest(noteID int64, tags []string) request {
+	return request{
 		Action:  "updateNoteTags",
 		Version: 6,
 		Params: map[string]any{
 			"note": noteID,
 			"tags": tags,
 		},
-	}, nil)
+	}
+}
+
+// multi sends reqs as one AnkiConnect `multi` action and decodes every
+// successful result into the matching element of results (nil elements are skipped).
+// The returned slice holds the per-action errors; the error return is set only
+// when the batch as a whole failed.
+func (c *Client) multi(ctx context.Context, reqs []request, results []any) ([]error, error) {
+	if len(reqs) == 0 {
+		return nil, nil
+	}
+
+	var raw []response
+	err := c.do(ctx, request{
+		Action:  "multi",
+		Version: 6,
+		Params: map[string]any{
+			"actions": reqs,
+		},
+	}, &raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != len(reqs) {
+		return nil, fmt.Errorf("multi: expected %d results, got %d", len(reqs), len(raw))
+	}
+
+	errs := make([]error, len(reqs))
+	for i, r := range raw {
+		if r.Error != nil {
+			errs[i] = fmt.Errorf("anki error: %s", *r.Error)
+			continue
+		}
+		if results[i] != nil {
+			errs[i] = json.Unmarshal(r.Result, results[i])
+		}
+	}
+
+	return errs, nil
 }
 
 func (c *Client) do(ctx context.Context, req request, result any) error {
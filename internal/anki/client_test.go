@@ -0,0 +1,196 @@
+package anki_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/anki/ankitest"
+)
+
+func basic(front, back string, tags ...string) anki.Note {
+	return anki.Note{Fields: map[string]string{"Front": front, "Back": back}, Tags: tags}
+}
+
+func TestAddNotes(t *testing.T) {
+	ctx := context.Background()
+	fake := ankitest.NewFake()
+
+	results, err := fake.AddNotes(ctx, "Default", "Basic", []anki.Note{
+		basic("cat", "кошка"),
+		basic("", "empty"),
+		basic("cat", "duplicate"),
+		{Fields: map[string]string{"Front": "dog", "Extra": "x"}},
+		basic("dog", "собака", "animals"),
+	})
+	if err != nil {
+		t.Fatalf("AddNotes() error = %v", err)
+	}
+
+	wantErrs := []string{"", "empty", "duplicate", "not a field", ""}
+	for i, want := range wantErrs {
+		r := results[i]
+		switch {
+		case want == "" && (r.Err != nil || r.ID == 0):
+			t.Errorf("note %d: got id %d, error %v, want a new note", i, r.ID, r.Err)
+		case want != "" && (r.Err == nil || !strings.Contains(r.Err.Error(), want)):
+			t.Errorf("note %d: got error %v, want one containing %q", i, r.Err, want)
+		}
+	}
+	if got := len(fake.Notes()); got != 2 {
+		t.Errorf("got %d notes in the collection, want 2", got)
+	}
+
+	fake.FailOn("multi", errors.New("collection is not available"))
+	if _, err := fake.AddNotes(ctx, "Default", "Basic", []anki.Note{basic("fox", "лиса")}); err == nil {
+		t.Error("AddNotes() with a failing multi returned no error")
+	}
+}
+
+func TestNotesExist(t *testing.T) {
+	ctx := context.Background()
+	fake := ankitest.NewFake()
+
+	if err := fake.CreateDeck(ctx, "Words"); err != nil {
+		t.Fatal(err)
+	}
+	results, err := fake.AddNotes(ctx, "Words", "Basic", []anki.Note{
+		basic("cat", "кошка", "anki-sync::id::c1"),
+		basic("Cat", "Кошка"),
+		basic("a*b", "wildcard"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both match the same search once the cloze markup is stripped.
+	if _, err := fake.AddNotes(ctx, "Words", "Cloze", []anki.Note{
+		{Fields: map[string]string{"Text": "{{c1::Paris}} is in France"}},
+		{Fields: map[string]string{"Text": "{{c2::Paris}} is in France"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fake.AddNotes(ctx, "Default", "Basic", []anki.Note{basic("dog", "собака")}); err != nil {
+		t.Fatal(err)
+	}
+	// Subdecks have sources of their own.
+	if err := fake.CreateDeck(ctx, "Words::Sub"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fake.AddNotes(ctx, "Words::Sub", "Basic", []anki.Note{basic("owl", "сова")}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		search  anki.NoteSearch
+		wantID  int64
+		wantErr string
+	}{
+		{name: "exact value", search: anki.NoteSearch{Field: "Front", Value: "cat"}, wantID: results[0].ID},
+		{name: "other case", search: anki.NoteSearch{Field: "Front", Value: "Cat"}, wantID: results[1].ID},
+		{name: "wildcards match literally", search: anki.NoteSearch{Field: "Front", Value: "a*b"}, wantID: results[2].ID},
+		{name: "tag", search: anki.NoteSearch{Tag: "anki-sync::id::c1"}, wantID: results[0].ID},
+		{name: "missing", search: anki.NoteSearch{Field: "Front", Value: "fox"}},
+		{name: "other deck", search: anki.NoteSearch{Field: "Front", Value: "dog"}},
+		{name: "subdeck", search: anki.NoteSearch{Field: "Front", Value: "owl"}},
+		{name: "several matches", search: anki.NoteSearch{Field: "Text", Value: "{{c1::Paris}} is in France", Cloze: true}, wantErr: "2 notes match"},
+	}
+
+	searches := make([]anki.NoteSearch, len(tests))
+	for i, tt := range tests {
+		searches[i] = tt.search
+	}
+	lookups, err := fake.NotesExist(ctx, "Words", searches)
+	if err != nil {
+		t.Fatalf("NotesExist() error = %v", err)
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := lookups[i]
+			if tt.wantErr != "" {
+				if l.Err == nil || !strings.Contains(l.Err.Error(), tt.wantErr) {
+					t.Errorf("got error %v, want one containing %q", l.Err, tt.wantErr)
+				}
+				return
+			}
+			if l.Err != nil || l.Exists != (tt.wantID != 0) || l.ID != tt.wantID {
+				t.Errorf("got %+v, want id %d", l, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestNotesExistFailures(t *testing.T) {
+	ctx := context.Background()
+	search := []anki.NoteSearch{{Field: "Front", Value: "cat"}}
+
+	tests := []struct {
+		name        string
+		action      string
+		wantErr     bool
+		wantItemErr bool
+	}{
+		{name: "lookup fails per item", action: "findNotes", wantItemErr: true},
+		{name: "notes info fails the batch", action: "notesInfo", wantErr: true},
+		{name: "multi fails the batch", action: "multi", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := ankitest.NewFake()
+			if _, err := fake.AddNotes(ctx, "Default", "Basic", []anki.Note{basic("cat", "кошка")}); err != nil {
+				t.Fatal(err)
+			}
+			boom := errors.New("boom")
+			fake.FailOn(tt.action, boom)
+
+			lookups, err := fake.NotesExist(ctx, "Default", search)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NotesExist() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), "boom") {
+					t.Errorf("got error %v, want the AnkiConnect one", err)
+				}
+				return
+			}
+			if got := lookups[0].Err != nil; got != tt.wantItemErr {
+				t.Errorf("got lookup error %v, want one: %v", lookups[0].Err, tt.wantItemErr)
+			}
+		})
+	}
+}
+
+func TestUpdateNotes(t *testing.T) {
+	ctx := context.Background()
+	fake := ankitest.NewFake()
+
+	results, err := fake.AddNotes(ctx, "Default", "Basic", []anki.Note{basic("cat", "кошка"), basic("dog", "собака")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs, err := fake.UpdateNotes(ctx, []anki.NoteUpdate{
+		{ID: results[0].ID, Fields: map[string]string{"Back": "кот"}},
+		{ID: results[1].ID, Tags: []string{"animals"}},
+		{ID: 12345, Fields: map[string]string{"Back": "x"}, Tags: []string{"x"}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateNotes() error = %v", err)
+	}
+	if errs[0] != nil || errs[1] != nil {
+		t.Errorf("got errors %v, %v for existing notes", errs[0], errs[1])
+	}
+	if errs[2] == nil || !strings.Contains(errs[2].Error(), "fields") || !strings.Contains(errs[2].Error(), "tags") {
+		t.Errorf("got error %v for a missing note, want both fields and tags to fail", errs[2])
+	}
+
+	notes := fake.Notes()
+	if notes[0].Fields["Back"] != "кот" || notes[0].Fields["Front"] != "cat" {
+		t.Errorf("got fields %v, want only Back updated", notes[0].Fields)
+	}
+	if len(notes[1].Tags) != 1 || notes[1].Tags[0] != "animals" || notes[1].Fields["Back"] != "собака" {
+		t.Errorf("got note %+v, want only its tags updated", notes[1])
+	}
+}
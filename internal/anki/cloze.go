@@ -0,0 +1,99 @@
+package anki
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// clozeMarker matches a cloze deletion: {{c1::text}} or {{c1::text::hint}}.
+var clozeMarker = regexp.MustCompile(`\{\{c\d+::(.*?)(?:::.*?)?\}\}`)
+
+// clozeDeletion matches a cloze deletion with its number and body.
+var clozeDeletion = regexp.MustCompile(`\{\{c(\d+)::(.*?)\}\}`)
+
+// braceEscaper escapes the braces the cloze shorthand treats specially.
+var braceEscaper = strings.NewReplacer("{", `\{`, "}", `\}`)
+
+// HasCloze reports whether a field value contains cloze deletions.
+func HasCloze(value string) bool {
+	return clozeMarker.MatchString(value)
+}
+
+// StripCloze replaces the cloze deletions of a field value with their text.
+func StripCloze(value string) string {
+	return clozeMarker.ReplaceAllString(value, "$1")
+}
+
+// ExpandCloze turns the cloze shorthand into cloze deletions. Every {text} is
+// a deletion of its own, numbered in order of appearance, and {text::hint}
+// shows a hint. \{ and \} are literal braces.
+//
+//	The capital of {France} is {Paris}
+//	The capital of {{c1::France}} is {{c2::Paris}}
+func ExpandCloze(text string) (string, error) {
+	var (
+		out     strings.Builder
+		deleted strings.Builder
+		open    = false
+		n       = 0
+	)
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		w := &out
+		if open {
+			w = &deleted
+		}
+		switch {
+		case c == '\\' && i+1 < len(text) && (text[i+1] == '{' || text[i+1] == '}'):
+			i++
+			w.WriteByte(text[i])
+		case c == '{':
+			if open {
+				return "", fmt.Errorf("cloze: nested { at offset %d", i)
+			}
+			open = true
+			deleted.Reset()
+		case c == '}':
+			if !open {
+				return "", fmt.Errorf("cloze: unmatched } at offset %d", i)
+			}
+			if strings.TrimSpace(deleted.String()) == "" {
+				return "", fmt.Errorf("cloze: empty deletion at offset %d", i)
+			}
+			open = false
+			n++
+			fmt.Fprintf(&out, "{{c%d::%s}}", n, deleted.String())
+		default:
+			w.WriteByte(c)
+		}
+	}
+	if open {
+		return "", fmt.Errorf("cloze: unclosed {")
+	}
+	if n == 0 {
+		return "", fmt.Errorf("cloze: no {deletions}")
+	}
+	return out.String(), nil
+}
+
+// CompactCloze is the reverse of ExpandCloze. It reports false when the
+// deletions aren't numbered c1, c2, ... in order, which the shorthand can't express.
+func CompactCloze(text string) (string, bool) {
+	var out strings.Builder
+	last := 0
+	for i, m := range clozeDeletion.FindAllStringSubmatchIndex(text, -1) {
+		if text[m[2]:m[3]] != strconv.Itoa(i+1) {
+			return "", false
+		}
+		out.WriteString(braceEscaper.Replace(text[last:m[0]]))
+		out.WriteString("{" + braceEscaper.Replace(text[m[4]:m[5]]) + "}")
+		last = m[1]
+	}
+	if last == 0 {
+		return "", false
+	}
+	out.WriteString(braceEscaper.Replace(text[last:]))
+	return out.String(), true
+}
@@ -0,0 +1,79 @@
+package anki
+
+import "testing"
+
+func TestExpandCloze(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{name: "numbered in order", text: "The capital of {France} is {Paris}", want: "The capital of {{c1::France}} is {{c2::Paris}}"},
+		{name: "hint", text: "{Paris::city}", want: "{{c1::Paris::city}}"},
+		{name: "escaped braces", text: `\{x\} is {y}`, want: "{x} is {{c1::y}}"},
+		{name: "escaped brace in deletion", text: `{a\}b}`, want: "{{c1::a}b}}"},
+		{name: "no deletions", text: "plain text", wantErr: true},
+		{name: "unclosed", text: "{open", wantErr: true},
+		{name: "unmatched", text: "close}", wantErr: true},
+		{name: "nested", text: "{a {b}}", wantErr: true},
+		{name: "empty", text: "{ }", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandCloze(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExpandCloze(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ExpandCloze(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompactCloze(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		want   string
+		wantOK bool
+	}{
+		{name: "in order", text: "The capital of {{c1::France}} is {{c2::Paris}}", want: "The capital of {France} is {Paris}", wantOK: true},
+		{name: "hint", text: "{{c1::Paris::city}}", want: "{Paris::city}", wantOK: true},
+		{name: "literal braces", text: "{x} is {{c1::y}}", want: `\{x\} is {y}`, wantOK: true},
+		{name: "out of order", text: "{{c2::a}} {{c1::b}}", wantOK: false},
+		{name: "shared number", text: "{{c1::a}} {{c1::b}}", wantOK: false},
+		{name: "no deletions", text: "plain text", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := CompactCloze(tt.text)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("CompactCloze(%q) = %q, %v, want %q, %v", tt.text, got, ok, tt.want, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			back, err := ExpandCloze(got)
+			if err != nil || back != tt.text {
+				t.Errorf("ExpandCloze(%q) = %q, %v, want %q", got, back, err, tt.text)
+			}
+		})
+	}
+}
+
+func TestStripCloze(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "{{c1::France}} and {{c2::Paris::city}}", want: "France and Paris"},
+		{text: "no deletions", want: "no deletions"},
+	}
+	for _, tt := range tests {
+		if got := StripCloze(tt.text); got != tt.want {
+			t.Errorf("StripCloze(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package anki
+
+import "context"
+
+// Connector is the set of AnkiConnect actions used by the managers.
+// Client implements it against a live AnkiConnect instance; tests can use
+// the in-memory implementation from the ankitest package instead.
+// Batched methods report errors per item and fail as a whole only when the
+// request itself could not be made.
+type Connector interface {
+	GetVersion(ctx context.Context) (string, error)
+
+	ModelExists(ctx context.Context, name string) (bool, error)
+	CreateModel(ctx context.Context, m Model) error
+	UpdateModelTemplates(ctx context.Context, name string, templates []CardTemplate) error
+	UpdateModelStyling(ctx context.Context, name string, css string) error
+	GetModelTemplates(ctx context.Context, name string) ([]CardTemplate, error)
+	GetModelStyling(ctx context.Context, name string) (string, error)
+	GetModelFieldNames(ctx context.Context, name string) ([]string, error)
+	ModelFieldAdd(ctx context.Context, model, field string, index int) error
+	ModelFieldRename(ctx context.Context, model, oldName, newName string) error
+	ModelFieldRemove(ctx context.Context, model, field string) error
+	ModelFieldReposition(ctx context.Context, model, field string, index int) error
+	ModelTemplateAdd(ctx context.Context, model string, t CardTemplate) error
+	ModelTemplateRename(ctx context.Context, model, oldName, newName string) error
+	ModelTemplateRemove(ctx context.Context, model, name string) error
+
+	DeckExists(ctx context.Context, name string) (bool, error)
+	DeckNames(ctx context.Context) ([]string, error)
+	CreateDeck(ctx context.Context, name string) error
+
+	AddNote(ctx context.Context, deck, model string, n Note) error
+	NoteExists(ctx context.Context, deck string, search NoteSearch) (bool, int64, error)
+	UpdateNoteFields(ctx context.Context, noteID int64, fields map[string]string) error
+	UpdateNoteTags(ctx context.Context, noteID int64, tags []string) error
+
+	FindNotes(ctx context.Context, query string) ([]int64, error)
+	NotesInfo(ctx context.Context, ids []int64) ([]NoteInfo, error)
+
+	NotesExist(ctx context.Context, deck string, searches []NoteSearch) ([]NoteLookup, error)
+	AddNotes(ctx context.Context, deck, model string, notes []Note) ([]NoteResult, error)
+	UpdateNotes(ctx context.Context, updates []NoteUpdate) ([]error, error)
+
+	DeleteNotes(ctx context.Context, ids []int64) error
+	SuspendCards(ctx context.Context, cardIDs []int64) error
+
+	StoreMediaFile(ctx context.Context, name string, data []byte) (string, error)
+	RetrieveMediaFile(ctx context.Context, name string) ([]byte, bool, error)
+	GetMediaFilesNames(ctx context.Context, pattern string) ([]string, error)
+}
+
+var _ Connector = (*Client)(nil)
@@ -0,0 +1,69 @@
+package anki
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Fields are the field names of a model in order. In YAML a field is either
+// its name or a mapping with the name and the name it is renamed from:
+//
+//	fields:
+//	  - Front
+//	  - name: Meaning
+//	    renamed_from: Back
+//
+// Renames are read by the parser into Model.RenamedFrom.
+type Fields []string
+
+func (f *Fields) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.SequenceNode {
+		return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: fields must be a list", value.Line)}}
+	}
+
+	var (
+		names []string
+		errs  []string
+	)
+	for _, item := range value.Content {
+		switch item.Kind {
+		case yaml.ScalarNode:
+			names = append(names, item.Value)
+		case yaml.MappingNode:
+			name, _, err := FieldSpec(item)
+			if err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			names = append(names, name)
+		default:
+			errs = append(errs, fmt.Sprintf("line %d: a field must be a name or a mapping with name and renamed_from", item.Line))
+		}
+	}
+	if len(errs) > 0 {
+		return &yaml.TypeError{Errors: errs}
+	}
+
+	*f = names
+	return nil
+}
+
+// FieldSpec reads a field given as a mapping.
+func FieldSpec(n *yaml.Node) (name, renamedFrom string, err error) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		switch key.Value {
+		case "name":
+			name = value.Value
+		case "renamed_from":
+			renamedFrom = value.Value
+		default:
+			return "", "", fmt.Errorf("line %d: field %s not found in type anki.Field", key.Line, key.Value)
+		}
+	}
+	if name == "" {
+		return "", "", fmt.Errorf("line %d: field has no name", n.Line)
+	}
+	return name, renamedFrom, nil
+}
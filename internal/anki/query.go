@@ -0,0 +1,107 @@
+package anki
+
+import "strings"
+
+// The functions below build terms of the Anki search syntax. Every value is
+// quoted and escaped, so spaces, quotes, colons and the wildcards `*` and `_`
+// in deck names, field values and tags match literally.
+
+// NoteSearch identifies a note of a deck by the exact value of a field, or by
+// a tag it carries.
+type NoteSearch struct {
+	Field string
+	Value string
+	// Tag is searched for instead of Field and Value when set.
+	Tag string
+	// Cloze compares the field without its cloze markup, so renumbering
+	// deletions or changing their hints keeps finding the note.
+	Cloze bool
+}
+
+// Term returns the search term finding the candidates of the search. Field
+// searches ignore case, so candidates still have to be compared with the
+// exact value, see Matches.
+func (s NoteSearch) Term() string {
+	if s.Tag != "" {
+		return TagSearch(s.Tag)
+	}
+	if s.Cloze {
+		return clozeSearch(s.Field, s.Value)
+	}
+	return FieldSearch(s.Field, s.Value)
+}
+
+// Matches reports whether a note found by Term is the one searched for.
+func (s NoteSearch) Matches(info NoteInfo) bool {
+	if s.Tag != "" {
+		for _, t := range info.Tags {
+			if strings.EqualFold(t, s.Tag) {
+				return true
+			}
+		}
+		return false
+	}
+	field, ok := info.Fields[s.Field]
+	if ok && s.Cloze {
+		return StripCloze(field.Value) == StripCloze(s.Value)
+	}
+	return ok && field.Value == s.Value
+}
+
+func (s NoteSearch) String() string {
+	if s.Tag != "" {
+		return "tag " + s.Tag
+	}
+	return s.Field + "=" + s.Value
+}
+
+// DeckSearch matches the notes of a deck and its subdecks.
+func DeckSearch(name string) string {
+	return quote("deck:" + escape(name))
+}
+
+// OnlyDeckSearch matches the notes of a deck without its subdecks.
+func OnlyDeckSearch(name string) string {
+	return Search(DeckSearch(name), Not(quote("deck:"+escape(name)+"::*")))
+}
+
+// FieldSearch matches the notes whose field equals value, ignoring case.
+func FieldSearch(field, value string) string {
+	return quote(field + ":" + escape(value))
+}
+
+// clozeSearch matches the notes whose field equals value, ignoring case and
+// the cloze deletions, which match anything.
+func clozeSearch(field, value string) string {
+	parts := clozeMarker.Split(value, -1)
+	for i, p := range parts {
+		parts[i] = escape(p)
+	}
+	return quote(field + ":" + strings.Join(parts, "*"))
+}
+
+// TagSearch matches the notes carrying a tag or one of its child tags.
+func TagSearch(tag string) string {
+	return quote("tag:" + escape(tag))
+}
+
+// Not negates a term.
+func Not(term string) string {
+	return "-" + term
+}
+
+// Search combines terms, all of which have to match.
+func Search(terms ...string) string {
+	return strings.Join(terms, " ")
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `*`, `\*`, `_`, `\_`)
+
+// escape makes a value match literally inside a quoted term.
+func escape(value string) string {
+	return escaper.Replace(value)
+}
+
+func quote(term string) string {
+	return `"` + term + `"`
+}
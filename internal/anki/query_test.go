@@ -0,0 +1,80 @@
+package anki
+
+import "testing"
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{name: "field", got: FieldSearch("Front", "cat"), want: `"Front:cat"`},
+		{name: "field with spaces and quotes", got: FieldSearch("Front", `say "hi" now`), want: `"Front:say \"hi\" now"`},
+		{name: "field with wildcards", got: FieldSearch("Front", `a*b_c`), want: `"Front:a\*b\_c"`},
+		{name: "field with backslash", got: FieldSearch("Front", `a\b`), want: `"Front:a\\b"`},
+		{name: "deck", got: DeckSearch("Lang::English words"), want: `"deck:Lang::English words"`},
+		{name: "only deck", got: OnlyDeckSearch("A_B"), want: `"deck:A\_B" -"deck:A\_B::*"`},
+		{name: "tag", got: TagSearch("anki-sync::id::x*"), want: `"tag:anki-sync::id::x\*"`},
+		{name: "not", got: Not(TagSearch("t")), want: `-"tag:t"`},
+		{name: "search", got: Search(DeckSearch("d"), TagSearch("t")), want: `"deck:d" "tag:t"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %s, want %s", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNoteSearch(t *testing.T) {
+	info := NoteInfo{
+		Tags:   []string{"Anki-Sync::id::One"},
+		Fields: map[string]NoteInfoField{"Front": {Value: "The capital of {{c1::France}} is {{c2::Paris}}"}},
+	}
+	tests := []struct {
+		name        string
+		search      NoteSearch
+		wantTerm    string
+		wantMatches bool
+	}{
+		{
+			name:        "field",
+			search:      NoteSearch{Field: "Front", Value: "The capital of {{c1::France}} is {{c2::Paris}}"},
+			wantTerm:    `"Front:The capital of {{c1::France}} is {{c2::Paris}}"`,
+			wantMatches: true,
+		},
+		{
+			name:     "field differs in case",
+			search:   NoteSearch{Field: "Front", Value: "the capital of {{c1::France}} is {{c2::Paris}}"},
+			wantTerm: `"Front:the capital of {{c1::France}} is {{c2::Paris}}"`,
+		},
+		{
+			name:        "cloze renumbered",
+			search:      NoteSearch{Field: "Front", Value: "The capital of {{c2::France::country}} is {{c1::Paris}}", Cloze: true},
+			wantTerm:    `"Front:The capital of * is *"`,
+			wantMatches: true,
+		},
+		{
+			name:        "tag ignores case",
+			search:      NoteSearch{Tag: "anki-sync::id::one"},
+			wantTerm:    `"tag:anki-sync::id::one"`,
+			wantMatches: true,
+		},
+		{
+			name:     "missing field",
+			search:   NoteSearch{Field: "Back", Value: ""},
+			wantTerm: `"Back:"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.search.Term(); got != tt.wantTerm {
+				t.Errorf("Term() = %s, want %s", got, tt.wantTerm)
+			}
+			if got := tt.search.Matches(info); got != tt.wantMatches {
+				t.Errorf("Matches() = %v, want %v", got, tt.wantMatches)
+			}
+		})
+	}
+}
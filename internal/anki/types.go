@@ -6,27 +6,136 @@ type Data struct {
 }
 
 type Model struct {
-	Name          string         `yaml:"name" json:"modelName"`
-	InOrderFields []string       `yaml:"fields" json:"inOrderFields"`
-	CSS           string         `yaml:"css,omitempty" json:"css,omitempty"`
-	IsCloze       bool           `yaml:"isCloze,omitempty" json:"isCloze,omitempty"`
+	Name          string `yaml:"name" json:"modelName"`
+	InOrderFields Fields `yaml:"fields" json:"inOrderFields"`
+	CSS           string `yaml:"css,omitempty" json:"css,omitempty"`
+	// CSSFile is a stylesheet, relative to the models file, used instead of CSS.
+	CSSFile string `yaml:"css_file,omitempty" json:"-"`
+	// IncludeCSS lists stylesheets, relative to the models file, put before
+	// the model's own CSS. Models share common styling this way.
+	IncludeCSS []string `yaml:"include_css,omitempty" json:"-"`
+	IsCloze    bool     `yaml:"isCloze,omitempty" json:"isCloze,omitempty"`
+	// CodeTheme is the theme code blocks in the fields of the model notes are
+	// highlighted with. Setting it highlights HTML fields too, not only
+	// Markdown ones.
+	CodeTheme     string         `yaml:"code_theme,omitempty" json:"-"`
 	CardTemplates []CardTemplate `yaml:"cardTemplates" json:"cardTemplates"`
+
+	// RenamedFrom maps fields to the names they had before, see Fields.
+	RenamedFrom map[string]string `yaml:"-" json:"-"`
+	// FieldLines maps fields to the lines they are declared at.
+	FieldLines map[string]int `yaml:"-" json:"-"`
+
+	// Source and Line locate the model definition. They are empty for models
+	// that only exist in Anki.
+	Source string `yaml:"-" json:"-"`
+	Line   int    `yaml:"-" json:"-"`
 }
 
 type CardTemplate struct {
 	Name  string `yaml:"name" json:"Name"`
-	Front string `yaml:"front" json:"Front"`
-	Back  string `yaml:"back" json:"Back"`
+	Front string `yaml:"front,omitempty" json:"Front"`
+	Back  string `yaml:"back,omitempty" json:"Back"`
+	// FrontFile and BackFile are HTML files, relative to the models file,
+	// used instead of Front and Back.
+	FrontFile string `yaml:"front_file,omitempty" json:"-"`
+	BackFile  string `yaml:"back_file,omitempty" json:"-"`
+	// RenamedFrom is the previous name of the template. Renaming keeps the
+	// cards of the template and their review history.
+	RenamedFrom string `yaml:"renamed_from,omitempty" json:"-"`
+
+	Line int `yaml:"-" json:"-"`
 }
 
 type Deck struct {
 	Deck         string `yaml:"deck_name"`
 	Model        string `yaml:"model_name"`
 	PrimaryField string `yaml:"primary_field"`
+	// Format is how the note fields are written, FormatHTML by default.
+	// FieldFormats overrides it for single fields.
+	Format       string            `yaml:"format,omitempty"`
+	FieldFormats map[string]string `yaml:"field_formats,omitempty"`
 	Notes        []Note
+
+	// Source is the path of the file the deck was loaded from.
+	Source string `yaml:"-"`
+	// Lines maps top level keys of the deck file to their line numbers.
+	Lines map[string]int `yaml:"-"`
+	// ReadOnly is set for decks loaded from files anki-sync doesn't write
+	// to, such as CSV tables.
+	ReadOnly bool `yaml:"-"`
+}
+
+// Field formats of a deck.
+const (
+	FormatHTML     = "html"
+	FormatMarkdown = "markdown"
+)
+
+// FieldFormat returns the format a field of the deck notes is written in.
+func (d Deck) FieldFormat(field string) string {
+	if f, ok := d.FieldFormats[field]; ok {
+		return f
+	}
+	if d.Format != "" {
+		return d.Format
+	}
+	return FormatHTML
 }
 
 type Note struct {
+	// ID is an optional stable identifier of the note, chosen by the user or
+	// assigned by `anki-sync assign-ids`. Notes with an id are found in Anki by
+	// it instead of their primary field value.
+	ID     string            `yaml:"id,omitempty"`
 	Fields map[string]string `yaml:"fields"`
-	Tags   []string          `yaml:"tags"`
+	// Cloze is the shorthand for the primary field of cloze notes, see
+	// ExpandCloze. The parser expands it into Fields.
+	Cloze string   `yaml:"cloze,omitempty"`
+	Tags  []string `yaml:"tags"`
+	// Media lists local files, relative to the deck file, used by the note.
+	// Images and sounds referenced from fields are picked up without listing them.
+	Media []string `yaml:"media,omitempty"`
+
+	// Line is the line the note starts at and FieldLines the lines of its fields.
+	Line       int            `yaml:"-"`
+	FieldLines map[string]int `yaml:"-"`
+	// Rendered keeps the source of the fields the parser rendered to HTML.
+	Rendered map[string]string `yaml:"-"`
+}
+
+// NoteInfo is a note as returned by the `notesInfo` action.
+type NoteInfo struct {
+	NoteID    int64                    `json:"noteId"`
+	ModelName string                   `json:"modelName"`
+	Tags      []string                 `json:"tags"`
+	Fields    map[string]NoteInfoField `json:"fields"`
+	Cards     []int64                  `json:"cards"`
+	Mod       int64                    `json:"mod"`
+}
+
+type NoteInfoField struct {
+	Value string `json:"value"`
+	Order int    `json:"order"`
+}
+
+// NoteLookup is the outcome of a single note search within a batch.
+type NoteLookup struct {
+	Exists bool
+	ID     int64
+	Err    error
+}
+
+// NoteResult is the outcome of a single note creation within a batch.
+type NoteResult struct {
+	ID  int64
+	Err error
+}
+
+// NoteUpdate is the desired fields and tags of an existing note.
+// A nil Fields or Tags means that part of the note stays as it is.
+type NoteUpdate struct {
+	ID     int64
+	Fields map[string]string
+	Tags   []string
 }
@@ -0,0 +1,43 @@
+package deck
+
+import (
+	"context"
+	"slices"
+
+	"github.com/spigell/anki-sync/internal/anki"
+)
+
+// NotesExist resolves the lookups of a deck in chunks of batchSize, so a
+// large deck never turns into a single huge request.
+func NotesExist(ctx context.Context, client anki.Connector, deck string, searches []anki.NoteSearch, batchSize int) ([]anki.NoteLookup, error) {
+	lookups := make([]anki.NoteLookup, 0, len(searches))
+	for chunk := range slices.Chunk(searches, batchSizeOrDefault(batchSize)) {
+		found, err := client.NotesExist(ctx, deck, chunk)
+		if err != nil {
+			return nil, err
+		}
+		lookups = append(lookups, found...)
+	}
+	return lookups, nil
+}
+
+// NotesInfo fetches notes in chunks of batchSize, so the request for a large
+// deck stays within the client timeout.
+func NotesInfo(ctx context.Context, client anki.Connector, ids []int64, batchSize int) ([]anki.NoteInfo, error) {
+	infos := make([]anki.NoteInfo, 0, len(ids))
+	for chunk := range slices.Chunk(ids, batchSizeOrDefault(batchSize)) {
+		found, err := client.NotesInfo(ctx, chunk)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, found...)
+	}
+	return infos, nil
+}
+
+func batchSizeOrDefault(n int) int {
+	if n < 1 {
+		return DefaultBatchSize
+	}
+	return n
+}
@@ -4,34 +4,61 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"sync"
 
 	"github.com/spigell/anki-sync/internal/anki"
 	"github.com/spigell/anki-sync/internal/logging"
+	"github.com/spigell/anki-sync/internal/media"
+	"github.com/spigell/anki-sync/internal/plan"
+	"github.com/spigell/anki-sync/internal/state"
 	"github.com/spigell/anki-sync/internal/workerpool"
 	"go.uber.org/zap"
 )
 
-const NoteTag = "anki-sync"
+const (
+	NoteTag = "anki-sync"
+	// IDTagPrefix starts the tag holding the id of a note, see anki.Note.ID.
+	IDTagPrefix = NoteTag + "::id::"
+
+	// DefaultBatchSize is the number of notes sent in a single AnkiConnect `multi` request.
+	DefaultBatchSize = 100
+)
 
 type Manager struct {
-	ctx      context.Context
-	client   *anki.Client
-	dryRun   bool
-	logger   *logging.Logger
-	data     *anki.Data
-	parallel int
+	ctx       context.Context
+	client    anki.Connector
+	dryRun    bool
+	logger    *logging.Logger
+	data      *anki.Data
+	parallel  int
+	batchSize int
+	pruneMode PruneMode
+	pruneMax  int
+	media     *media.Uploader
+	state     *state.State
+	refresh   bool
+	stats     stats
+
+	// claimed are the notes in Anki matched by a source note. They are never
+	// pruned, whatever their primary field value in Anki is.
+	claimedMu sync.Mutex
+	claimed   map[int64]bool
 }
 
 type ManagerOption func(*Manager)
 
-func NewDeckManager(ctx context.Context, client *anki.Client, dryRun bool, logger *logging.Logger, data *anki.Data, opts ...ManagerOption) *Manager {
+func NewDeckManager(ctx context.Context, client anki.Connector, dryRun bool, logger *logging.Logger, data *anki.Data, opts ...ManagerOption) *Manager {
 	m := &Manager{
 		ctx:    ctx,
 		client: client,
 		dryRun: dryRun,
 		logger: logger,
 		data:   data,
+		media:  media.NewUploader(client, dryRun, logger),
+
+		batchSize: DefaultBatchSize,
+		claimed:   make(map[int64]bool),
 	}
 
 	for _, opt := range opts {
@@ -47,6 +74,30 @@ func WithNoteUploadParallelism(n int) ManagerOption {
 	}
 }
 
+// WithBatchSize sets how many notes are created or updated per AnkiConnect
+// request. Values below 1 keep DefaultBatchSize.
+func WithBatchSize(n int) ManagerOption {
+	return func(m *Manager) {
+		m.batchSize = batchSizeOrDefault(n)
+	}
+}
+
+// WithState skips notes recorded in s with the same content and records the
+// synced notes in it.
+func WithState(s *state.State) ManagerOption {
+	return func(m *Manager) {
+		m.state = s
+	}
+}
+
+// WithRefresh compares every note with Anki, even the ones the state records
+// as unchanged.
+func WithRefresh(refresh bool) ManagerOption {
+	return func(m *Manager) {
+		m.refresh = refresh
+	}
+}
+
 //nolint:gocognit // To do.
 func (m *Manager) Sync() error {
 	if len(m.data.Decks) == 0 {
@@ -102,29 +153,34 @@ func (m *Manager) Sync() error {
 				}
 			}
 
-			deckLogger.Info("launch new workerpool for uploading notes", zap.Int("worker_count", m.parallel))
-			pool := workerpool.New(m.parallel)
-			pool.Start(m.ctx)
-
-			for _, note := range deck.Notes {
-				n := note // capture range var
-				pool.Submit(func(ctx context.Context) error {
-					err := m.ensureNote(ctx, deck, n, deckLogger)
-					if err != nil {
-						errsMu.Lock()
-						errs = append(errs, err)
-						errsMu.Unlock()
-					}
-					return err
-				})
+			if err := m.syncNotes(deck, deckLogger); err != nil {
+				errsMu.Lock()
+				errs = append(errs, err)
+				errsMu.Unlock()
 			}
-
-			pool.Stop()
 		}(deck)
 	}
 
 	wg.Wait()
 
+	// Removing notes is only safe when the sources were synced completely.
+	if m.pruneMode != "" {
+		if len(errs) > 0 {
+			m.logger.Warn("pruning is skipped because of sync errors")
+		} else if err := m.prune(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	st := m.stats.get()
+	m.logger.Info("notes sync summary",
+		zap.Int("created", st.Created),
+		zap.Int("updated", st.Updated),
+		zap.Int("unchanged", st.Unchanged),
+		zap.Int("pruned", st.Pruned),
+		zap.Int("failed", st.Failed),
+	)
+
 	if len(errs) > 0 {
 		return errors.Join(errs...)
 	}
@@ -132,48 +188,190 @@ func (m *Manager) Sync() error {
 	return nil
 }
 
-func (m *Manager) ensureNote(ctx context.Context, deck anki.Deck, note anki.Note, logger *logging.Logger) error {
-	note.Tags = append(note.Tags, NoteTag)
-
-	exists, id, err := m.client.NoteExists(m.ctx, deck.Deck, fmt.Sprintf("%s:%s", deck.PrimaryField, note.Fields[deck.PrimaryField]))
+// syncNotes resolves all notes of the deck with a single lookup request and
+// then creates or updates them in chunks of batchSize.
+func (m *Manager) syncNotes(deck anki.Deck, logger *logging.Logger) error {
+	r, err := m.resolve(deck, logger)
 	if err != nil {
-		return fmt.Errorf("error while getting status of note: %w", err)
+		return err
 	}
+	m.claim(r.ids)
 
-	l := logger.CloneWith(zap.Int64("noteId", id))
+	var (
+		notes    = r.notes
+		ids      = r.ids
+		toCreate = r.toCreate
+		updates  = r.updates
+		errs     = r.errs
+	)
+
+	m.stats.add(Stats{Unchanged: r.unchanged, Failed: len(errs)})
 
-	if exists {
-		l.Info("note exists", zap.String("primary_field", deck.PrimaryField))
+	// synced marks the notes that match the sources once the batches are done.
+	synced := make([]bool, len(notes))
+	for i, id := range r.ids {
+		synced[i] = id != 0
+	}
+	for _, u := range updates {
+		synced[u.index] = false
 	}
 
 	if m.dryRun {
-		if !exists {
-			l.DryRunLogger().Info("would create note", zap.Any("fields", note.Fields))
+		for _, i := range toCreate {
+			logger.DryRunLogger().Info("would create note", zap.Any("fields", notes[i].Fields), zap.Any("tags", notes[i].Tags))
 		}
-		l.DryRunLogger().Info("would update note fields", zap.Any("fields", note.Fields))
-		l.DryRunLogger().Info("would update note tags", zap.Any("tags", note.Tags))
-		return nil
+		for _, u := range updates {
+			l := logger.DryRunLogger().With(zap.Int64("noteId", u.update.ID))
+			if u.update.Fields != nil {
+				l.Info("would update note fields", zap.Any("fields", u.update.Fields))
+			}
+			if u.update.Tags != nil {
+				l.Info("would update note tags", zap.Any("tags", u.update.Tags))
+			}
+		}
+		m.stats.add(Stats{Created: len(toCreate), Updated: len(updates)})
+		return errors.Join(errs...)
 	}
 
-	if !exists {
-		if err := m.client.AddNote(ctx, deck.Deck, deck.Model, note); err != nil {
-			return err
+	var errsMu sync.Mutex
+	collect := func(err error) {
+		errsMu.Lock()
+		errs = append(errs, err)
+		errsMu.Unlock()
+	}
+
+	logger.Info("launch new workerpool for uploading notes", zap.Int("worker_count", m.parallel), zap.Int("batch_size", m.batchSize))
+	pool := workerpool.New(m.parallel)
+	pool.Start(m.ctx)
+
+	for chunk := range slices.Chunk(toCreate, m.batchSize) {
+		pool.Submit(func(ctx context.Context) error {
+			batch := make([]anki.Note, len(chunk))
+			for j, i := range chunk {
+				batch[j] = notes[i]
+			}
+
+			results, err := m.client.AddNotes(ctx, deck.Deck, deck.Model, batch)
+			if err != nil {
+				collect(fmt.Errorf("error while creating notes in deck %s: %w", deck.Deck, err))
+				return err
+			}
+			for j, r := range results {
+				if r.Err != nil {
+					m.stats.add(Stats{Failed: 1})
+					collect(noteError(deck, batch[j], r.Err))
+					continue
+				}
+				m.stats.add(Stats{Created: 1})
+				logger.Info("note created", zap.Int64("noteId", r.ID))
+				ids[chunk[j]] = r.ID
+				synced[chunk[j]] = true
+			}
+			return nil
+		})
+	}
+
+	for chunk := range slices.Chunk(updates, m.batchSize) {
+		pool.Submit(func(ctx context.Context) error {
+			batch := make([]anki.NoteUpdate, len(chunk))
+			for j, u := range chunk {
+				batch[j] = u.update
+			}
+
+			updateErrs, err := m.client.UpdateNotes(ctx, batch)
+			if err != nil {
+				collect(fmt.Errorf("error while updating notes in deck %s: %w", deck.Deck, err))
+				return err
+			}
+			for j, err := range updateErrs {
+				if err != nil {
+					m.stats.add(Stats{Failed: 1})
+					collect(noteError(deck, notes[chunk[j].index], err))
+					continue
+				}
+				m.stats.add(Stats{Updated: 1})
+				logger.Info("note updated", zap.Int64("noteId", batch[j].ID),
+					zap.Bool("fields", batch[j].Fields != nil), zap.Bool("tags", batch[j].Tags != nil))
+				synced[chunk[j].index] = true
+			}
+			return nil
+		})
+	}
+
+	pool.Stop()
+	// Notes created by this run are claimed once they have an ID, so
+	// pruning never removes them.
+	m.claim(ids)
+
+	if m.state != nil {
+		for i, ok := range synced {
+			if !ok {
+				continue
+			}
+			if old, ok := r.renamed[i]; ok {
+				m.state.Forget(deck.Deck, old)
+			}
+			m.state.Record(deck.Deck, notes[i].Fields[deck.PrimaryField], r.sources[i], ids[i], notes[i])
 		}
-		_, id, err = m.client.NoteExists(m.ctx, deck.Deck, fmt.Sprintf("%s:%s", deck.PrimaryField, note.Fields[deck.PrimaryField]))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Plan adds the decks and notes Sync would create or update to p without applying anything.
+// Notes that can't be resolved are recorded in p.Errors.
+func (m *Manager) Plan(p *plan.Plan) error {
+	seen := make(map[string]bool)
+
+	for _, deck := range m.data.Decks {
+		if !seen[deck.Deck] {
+			seen[deck.Deck] = true
+
+			exists, err := m.client.DeckExists(m.ctx, deck.Deck)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				p.Decks = append(p.Decks, plan.DeckChange{Name: deck.Deck, Action: plan.Create})
+			}
+		}
+
+		r, err := m.resolve(deck, m.logger)
 		if err != nil {
-			return fmt.Errorf("error while getting status of note after creation: %w", err)
+			return err
 		}
-		logger.Info("note created", zap.Int64("noteId", id))
+		m.claim(r.ids)
+		for _, err := range r.errs {
+			p.Errors = append(p.Errors, err.Error())
+		}
+		p.Notes = append(p.Notes, r.changes(deck)...)
 	}
 
-	if err := m.client.UpdateNoteTags(ctx, id, note.Tags); err != nil {
-		return fmt.Errorf("error while updating tags of note: %w", err)
+	if m.pruneMode != "" {
+		return m.planPrune(p)
 	}
 
-	if err := m.client.UpdateNoteFields(ctx, id, note.Fields); err != nil {
-		return fmt.Errorf("error while updating fields of note: %w", err)
+	return nil
+}
+
+// Stats returns the counts of the last Sync run.
+// In dry-run mode they are the counts of what would have been done.
+func (m *Manager) Stats() Stats {
+	return m.stats.get()
+}
+
+func (m *Manager) claim(ids []int64) {
+	m.claimedMu.Lock()
+	defer m.claimedMu.Unlock()
+
+	for _, id := range ids {
+		if id != 0 {
+			m.claimed[id] = true
+		}
 	}
+}
 
-	logger.Info("tags and fields updated", zap.Int64("noteId", id))
-	return nil
+// noteError attributes err to the note it happened for.
+func noteError(deck anki.Deck, note anki.Note, err error) error {
+	return fmt.Errorf("deck %s, note %s: %w", deck.Deck, noteKey(deck, note), err)
 }
@@ -0,0 +1,354 @@
+package deck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/anki/ankitest"
+	"github.com/spigell/anki-sync/internal/logging"
+	"github.com/spigell/anki-sync/internal/state"
+	"go.uber.org/zap"
+)
+
+func testLogger() *logging.Logger {
+	return &logging.Logger{Logger: zap.NewNop()}
+}
+
+func words(notes ...anki.Note) anki.Deck {
+	return anki.Deck{Deck: "Words", Model: "Basic", PrimaryField: "Front", Notes: notes}
+}
+
+func word(front, back string, tags ...string) anki.Note {
+	return anki.Note{Fields: map[string]string{"Front": front, "Back": back}, Tags: tags}
+}
+
+func runSync(t *testing.T, client anki.Connector, deck anki.Deck, opts ...ManagerOption) (Stats, error) {
+	t.Helper()
+	opts = append([]ManagerOption{WithNoteUploadParallelism(2)}, opts...)
+	m := NewDeckManager(context.Background(), client, false, testLogger(), &anki.Data{Decks: []anki.Deck{deck}}, opts...)
+	err := m.Sync()
+	return m.Stats(), err
+}
+
+func TestSyncNoteErrors(t *testing.T) {
+	fake := ankitest.NewFake()
+
+	// A field the model lacks fails its own note, the batch goes on.
+	bad := anki.Note{Fields: map[string]string{"Front": "owl", "Extra": "x"}}
+	stats, err := runSync(t, fake, words(word("cat", "кошка"), bad, word("dog", "собака")))
+	if err == nil || !strings.Contains(err.Error(), `Front="owl"`) {
+		t.Fatalf("Sync() error = %v, want one naming the failed note", err)
+	}
+	if want := (Stats{Created: 2, Failed: 1}); stats != want {
+		t.Errorf("Sync() stats = %+v, want %+v", stats, want)
+	}
+	if got := len(fake.Notes()); got != 2 {
+		t.Errorf("got %d notes in Anki, want 2", got)
+	}
+}
+
+func TestSyncFailures(t *testing.T) {
+	notes := []anki.Note{word("cat", "кошка"), word("dog", "собака")}
+
+	tests := []struct {
+		name   string
+		action string
+		// existing notes are synced before the action starts failing.
+		existing bool
+		want     Stats
+	}{
+		{name: "deck creation", action: "createDeck"},
+		{name: "lookup", action: "findNotes", want: Stats{Failed: 2}},
+		{name: "notes info", action: "notesInfo", existing: true},
+		{name: "creation", action: "addNote", want: Stats{Failed: 2}},
+		{name: "update", action: "updateNoteFields", existing: true, want: Stats{Failed: 2}},
+		{name: "whole batch", action: "multi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := ankitest.NewFake()
+			if tt.existing {
+				if _, err := runSync(t, fake, words(notes...)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			fake.FailOn(tt.action, errors.New("collection is not available"))
+			changed := []anki.Note{word("cat", "кот"), word("dog", "пёс")}
+			stats, err := runSync(t, fake, words(changed...))
+			if err == nil || !strings.Contains(err.Error(), "collection is not available") {
+				t.Fatalf("Sync() error = %v, want the AnkiConnect one", err)
+			}
+			if stats != tt.want {
+				t.Errorf("Sync() stats = %+v, want %+v", stats, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncBatchSize(t *testing.T) {
+	for _, size := range []int{-1, 0, 1, 2} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			fake := ankitest.NewFake()
+
+			stats, err := runSync(t, fake, words(word("cat", "кошка"), word("dog", "собака"), word("fox", "лиса")), WithBatchSize(size))
+			if err != nil {
+				t.Fatalf("first Sync() error = %v", err)
+			}
+			if want := (Stats{Created: 3}); stats != want {
+				t.Errorf("first Sync() stats = %+v, want %+v", stats, want)
+			}
+
+			stats, err = runSync(t, fake, words(word("cat", "кот"), word("dog", "пёс"), word("fox", "лиса")), WithBatchSize(size))
+			if err != nil {
+				t.Fatalf("second Sync() error = %v", err)
+			}
+			if want := (Stats{Updated: 2, Unchanged: 1}); stats != want {
+				t.Errorf("second Sync() stats = %+v, want %+v", stats, want)
+			}
+		})
+	}
+}
+
+func TestSync(t *testing.T) {
+	fake := ankitest.NewFake()
+
+	stats, err := runSync(t, fake, words(word("cat", "кошка"), word("dog", "собака"), word("fox", "лиса")))
+	if err != nil {
+		t.Fatalf("first Sync() error = %v", err)
+	}
+	if want := (Stats{Created: 3}); stats != want {
+		t.Errorf("first Sync() stats = %+v, want %+v", stats, want)
+	}
+	if !slices.Contains(fake.Decks(), "Words") {
+		t.Errorf("deck Words was not created, decks: %v", fake.Decks())
+	}
+
+	tests := []struct {
+		name  string
+		notes []anki.Note
+		want  Stats
+	}{
+		{name: "unchanged", notes: []anki.Note{word("cat", "кошка"), word("dog", "собака"), word("fox", "лиса")}, want: Stats{Unchanged: 3}},
+		{name: "field changed", notes: []anki.Note{word("cat", "кот"), word("dog", "собака"), word("fox", "лиса")}, want: Stats{Updated: 1, Unchanged: 2}},
+		{name: "tags changed", notes: []anki.Note{word("cat", "кот", "animals"), word("dog", "собака"), word("fox", "лиса")}, want: Stats{Updated: 1, Unchanged: 2}},
+		{name: "note added", notes: []anki.Note{word("cat", "кот", "animals"), word("dog", "собака"), word("fox", "лиса"), word("owl", "сова")}, want: Stats{Created: 1, Unchanged: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Single note batches make every lookup and update a request of its own.
+			stats, err := runSync(t, fake, words(tt.notes...), WithBatchSize(1))
+			if err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			if stats != tt.want {
+				t.Errorf("Sync() stats = %+v, want %+v", stats, tt.want)
+			}
+		})
+	}
+
+	notes := fake.Notes()
+	if len(notes) != 4 {
+		t.Fatalf("got %d notes in Anki, want 4", len(notes))
+	}
+	cat := notes[0]
+	if cat.Fields["Back"] != "кот" || !slices.Contains(cat.Tags, "animals") || !slices.Contains(cat.Tags, NoteTag) {
+		t.Errorf("got note %+v, want the updated fields and tags with %s", cat, NoteTag)
+	}
+}
+
+func TestSyncDryRun(t *testing.T) {
+	fake := ankitest.NewFake()
+	deck := words(word("cat", "кошка"))
+
+	m := NewDeckManager(context.Background(), fake, true, testLogger(), &anki.Data{Decks: []anki.Deck{deck}})
+	if err := m.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if want := (Stats{Created: 1}); m.Stats() != want {
+		t.Errorf("Sync() stats = %+v, want %+v", m.Stats(), want)
+	}
+	if len(fake.Notes()) != 0 || slices.Contains(fake.Decks(), "Words") {
+		t.Errorf("dry run changed Anki: decks %v, notes %v", fake.Decks(), fake.Notes())
+	}
+}
+
+func TestDiffNote(t *testing.T) {
+	info := anki.NoteInfo{
+		Tags: []string{"animals", NoteTag},
+		Fields: map[string]anki.NoteInfoField{
+			"Front": {Value: "cat"},
+			"Back":  {Value: "кошка"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		note       anki.Note
+		wantFields map[string]string
+		wantTags   []string
+	}{
+		{
+			name: "unchanged",
+			note: anki.Note{Fields: map[string]string{"Front": "cat", "Back": "кошка"}, Tags: []string{NoteTag, "animals"}},
+		},
+		{
+			name: "duplicate tags",
+			note: anki.Note{Fields: map[string]string{"Front": "cat"}, Tags: []string{"animals", NoteTag, "animals", ""}},
+		},
+		{
+			name:       "field changed",
+			note:       anki.Note{Fields: map[string]string{"Front": "cat", "Back": "кот"}, Tags: []string{"animals", NoteTag}},
+			wantFields: map[string]string{"Back": "кот"},
+		},
+		{
+			name:       "field unknown in Anki",
+			note:       anki.Note{Fields: map[string]string{"Front": "cat", "Extra": ""}, Tags: []string{"animals", NoteTag}},
+			wantFields: map[string]string{"Extra": ""},
+		},
+		{
+			name:     "tags changed",
+			note:     anki.Note{Fields: map[string]string{"Front": "cat"}, Tags: []string{NoteTag}},
+			wantTags: []string{NoteTag},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffNote(tt.note, info)
+			if !maps.Equal(got.Fields, tt.wantFields) {
+				t.Errorf("diffNote() fields = %v, want %v", got.Fields, tt.wantFields)
+			}
+			if !slices.Equal(got.Tags, tt.wantTags) {
+				t.Errorf("diffNote() tags = %v, want %v", got.Tags, tt.wantTags)
+			}
+		})
+	}
+}
+
+func TestSyncNoteIDs(t *testing.T) {
+	fake := ankitest.NewFake()
+
+	withID := func(id string, note anki.Note) anki.Note {
+		note.ID = id
+		return note
+	}
+
+	tests := []struct {
+		name string
+		note anki.Note
+		want Stats
+	}{
+		{name: "without id", note: word("cat", "кошка"), want: Stats{Created: 1}},
+		{name: "id assigned", note: withID("c1", word("cat", "кошка")), want: Stats{Updated: 1}},
+		{name: "primary field renamed", note: withID("c1", word("kitten", "кошка")), want: Stats{Updated: 1}},
+		{name: "unchanged", note: withID("c1", word("kitten", "кошка")), want: Stats{Unchanged: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := runSync(t, fake, words(tt.note))
+			if err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			if stats != tt.want {
+				t.Errorf("Sync() stats = %+v, want %+v", stats, tt.want)
+			}
+		})
+	}
+
+	notes := fake.Notes()
+	if len(notes) != 1 {
+		t.Fatalf("got %d notes in Anki, want 1", len(notes))
+	}
+	if notes[0].Fields["Front"] != "kitten" || IDFromTags(notes[0].Tags) != "c1" {
+		t.Errorf("got note %+v, want kitten with id c1", notes[0])
+	}
+}
+
+func TestSyncRenames(t *testing.T) {
+	fake := ankitest.NewFake()
+	st := state.New()
+
+	tests := []struct {
+		name      string
+		notes     []anki.Note
+		want      Stats
+		wantNotes map[string]string
+	}{
+		{
+			name:      "created",
+			notes:     []anki.Note{word("cat", "кошка"), word("dog", "собака")},
+			want:      Stats{Created: 2},
+			wantNotes: map[string]string{"cat": "кошка", "dog": "собака"},
+		},
+		{
+			name:      "primary field edited",
+			notes:     []anki.Note{word("kitten", "кошка"), word("dog", "собака")},
+			want:      Stats{Updated: 1, Unchanged: 1},
+			wantNotes: map[string]string{"kitten": "кошка", "dog": "собака"},
+		},
+		{
+			// The removed note keeps its review history in Anki.
+			name:      "other note in the same place",
+			notes:     []anki.Note{word("owl", "сова"), word("dog", "собака")},
+			want:      Stats{Created: 1, Unchanged: 1},
+			wantNotes: map[string]string{"kitten": "кошка", "dog": "собака", "owl": "сова"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := runSync(t, fake, words(tt.notes...), WithState(st))
+			if err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			if stats != tt.want {
+				t.Errorf("Sync() stats = %+v, want %+v", stats, tt.want)
+			}
+			got := make(map[string]string)
+			for _, n := range fake.Notes() {
+				got[n.Fields["Front"]] = n.Fields["Back"]
+			}
+			if !maps.Equal(got, tt.wantNotes) {
+				t.Errorf("notes in Anki = %v, want %v", got, tt.wantNotes)
+			}
+		})
+	}
+}
+
+func TestSyncPrune(t *testing.T) {
+	fake := ankitest.NewFake()
+
+	tests := []struct {
+		name      string
+		notes     []anki.Note
+		want      Stats
+		wantNotes []string
+	}{
+		// Notes created by the run are never orphans.
+		{name: "created", notes: []anki.Note{word("cat", "кошка"), word("dog", "собака")}, want: Stats{Created: 2}, wantNotes: []string{"cat", "dog"}},
+		{name: "removed from the deck", notes: []anki.Note{word("dog", "собака"), word("owl", "сова")}, want: Stats{Created: 1, Unchanged: 1, Pruned: 1}, wantNotes: []string{"dog", "owl"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := runSync(t, fake, words(tt.notes...), WithPrune(PruneDelete, 0))
+			if err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			if stats != tt.want {
+				t.Errorf("Sync() stats = %+v, want %+v", stats, tt.want)
+			}
+			var got []string
+			for _, n := range fake.Notes() {
+				got = append(got, n.Fields["Front"])
+			}
+			if !slices.Equal(got, tt.wantNotes) {
+				t.Errorf("notes in Anki = %v, want %v", got, tt.wantNotes)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package deck
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/logging"
+	"github.com/spigell/anki-sync/internal/media"
+	"github.com/spigell/anki-sync/internal/plan"
+	"github.com/spigell/anki-sync/internal/state"
+	"go.uber.org/zap"
+)
+
+// Stats counts notes by the outcome of a sync.
+type Stats struct {
+	Created   int
+	Updated   int
+	Unchanged int
+	Pruned    int
+	Failed    int
+}
+
+type stats struct {
+	mu sync.Mutex
+	s  Stats
+}
+
+func (s *stats) add(d Stats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.s.Created += d.Created
+	s.s.Updated += d.Updated
+	s.s.Unchanged += d.Unchanged
+	s.s.Pruned += d.Pruned
+	s.s.Failed += d.Failed
+}
+
+func (s *stats) get() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.s
+}
+
+// pendingUpdate is an update of the note at index of the deck notes.
+type pendingUpdate struct {
+	index  int
+	update anki.NoteUpdate
+	info   anki.NoteInfo
+}
+
+// resolved is a deck with every note classified against the state of Anki.
+type resolved struct {
+	// notes are the deck notes with NoteTag added.
+	notes []anki.Note
+	// sources are the source keys of the notes.
+	sources []string
+	// ids are the IDs of the notes found in Anki, 0 for the others.
+	ids      []int64
+	toCreate []int
+	updates  []pendingUpdate
+	// renamed maps notes found by their source key to the primary field
+	// value recorded for them.
+	renamed   map[int]string
+	unchanged int
+	// errs are per-note errors; such notes are neither created nor updated.
+	errs []error
+}
+
+// resolve classifies the notes of the deck. Notes recorded in the state with
+// the same content are unchanged without asking Anki; the others are looked
+// up with a single request and compared with their current state in Anki.
+// A note whose primary field value is unknown but whose position in the
+// source is recorded for a value gone from the deck is a rename of that note.
+//
+//nolint:gocognit // To do.
+func (m *Manager) resolve(deck anki.Deck, logger *logging.Logger) (*resolved, error) {
+	r := &resolved{renamed: make(map[int]string)}
+	dir := filepath.Dir(deck.Source)
+
+	type source struct {
+		note   anki.Note
+		key    string
+		local  anki.Note
+		source string
+	}
+	var sources []source
+	primaries := make(map[string]bool, len(deck.Notes))
+	for idx, note := range deck.Notes {
+		local, _, err := media.Resolve(dir, note)
+		if err != nil {
+			r.errs = append(r.errs, noteError(deck, note, err))
+			continue
+		}
+		local.Tags = Tags(note)
+		key := local.Fields[deck.PrimaryField]
+		primaries[key] = true
+		src := state.SourceKey(deck.Source, idx)
+		if note.ID != "" {
+			src = state.IDKey(note.ID)
+		}
+		sources = append(sources, source{note: note, key: key, local: local, source: src})
+	}
+
+	var (
+		existing     []int
+		lookup       []int
+		searchFields []anki.NoteSearch
+	)
+	for _, src := range sources {
+		i := len(r.notes)
+
+		if m.state != nil {
+			if known, ok := m.state.Get(deck.Deck, src.key); ok && !m.refresh && known.NoteID != 0 && known.Hash == state.ContentHash(src.local) {
+				r.notes = append(r.notes, src.local)
+				r.sources = append(r.sources, src.source)
+				r.ids = append(r.ids, known.NoteID)
+				r.unchanged++
+				continue
+			}
+		}
+
+		note, err := m.media.Rewrite(m.ctx, dir, src.note)
+		if err != nil {
+			r.errs = append(r.errs, noteError(deck, src.note, err))
+			continue
+		}
+		note.Tags = src.local.Tags
+		r.notes = append(r.notes, note)
+		r.sources = append(r.sources, src.source)
+		r.ids = append(r.ids, 0)
+
+		if m.state != nil {
+			if _, ok := m.state.Get(deck.Deck, src.key); !ok {
+				// A position in the file alone doesn't make a rename: a
+				// different note may have taken the place of a removed one.
+				if old, ok := m.state.BySource(deck.Deck, src.source); ok && old.NoteID != 0 && !primaries[old.Key] &&
+					(src.note.ID != "" || sameContent(old, src.local, deck.PrimaryField)) {
+					r.ids[i] = old.NoteID
+					r.renamed[i] = old.Key
+					existing = append(existing, i)
+					logger.Debug("note renamed", zap.Int64("noteId", old.NoteID), zap.String("from", old.Key), zap.String("to", src.key))
+					continue
+				}
+			}
+		}
+
+		lookup = append(lookup, i)
+		searchFields = append(searchFields, Lookup(deck, note))
+	}
+
+	// Notes given an id since the last sync don't carry its tag in Anki yet
+	// and are looked up by their primary field value once more.
+	for pass := 0; len(lookup) > 0; pass++ {
+		lookups, err := NotesExist(m.ctx, m.client, deck.Deck, searchFields, m.batchSize)
+		if err != nil {
+			return nil, fmt.Errorf("error while getting status of notes in deck %s: %w", deck.Deck, err)
+		}
+
+		var retry []int
+		searchFields = nil
+		for j, l := range lookups {
+			i := lookup[j]
+			switch {
+			case l.Err != nil:
+				r.errs = append(r.errs, noteError(deck, r.notes[i], fmt.Errorf("error while getting status of note: %w", l.Err)))
+			case l.Exists:
+				r.ids[i] = l.ID
+				existing = append(existing, i)
+				logger.Debug("note exists", zap.Int64("noteId", l.ID), zap.String("primary_field", deck.PrimaryField))
+			case pass == 0 && r.notes[i].ID != "":
+				retry = append(retry, i)
+				searchFields = append(searchFields, primaryLookup(deck, r.notes[i]))
+			default:
+				r.toCreate = append(r.toCreate, i)
+			}
+		}
+		lookup = retry
+	}
+
+	updates, missing, err := m.changedNotes(r.notes, r.ids, existing)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting notes of deck %s: %w", deck.Deck, err)
+	}
+	r.updates = updates
+	r.unchanged += len(existing) - len(updates) - len(missing)
+
+	// Notes recorded in the state may have been deleted in Anki since.
+	for _, i := range missing {
+		r.ids[i] = 0
+		delete(r.renamed, i)
+		r.toCreate = append(r.toCreate, i)
+	}
+	sort.Ints(r.toCreate)
+
+	return r, nil
+}
+
+// changes describes the resolved deck as plan entries.
+func (r *resolved) changes(deck anki.Deck) []plan.NoteChange {
+	changes := make([]plan.NoteChange, 0, len(r.toCreate)+len(r.updates))
+
+	for _, i := range r.toCreate {
+		note := r.notes[i]
+		c := plan.NoteChange{
+			Deck:      deck.Deck,
+			Model:     deck.Model,
+			Action:    plan.Create,
+			Key:       noteKey(deck, note),
+			Fields:    make(map[string]plan.TextChange, len(note.Fields)),
+			TagsAdded: normalizeTags(note.Tags),
+		}
+		for name, value := range note.Fields {
+			c.Fields[name] = plan.TextChange{After: value}
+		}
+		changes = append(changes, c)
+	}
+
+	for _, u := range r.updates {
+		c := plan.NoteChange{
+			Deck:   deck.Deck,
+			Model:  deck.Model,
+			Action: plan.Update,
+			Key:    noteKey(deck, r.notes[u.index]),
+			NoteID: u.update.ID,
+		}
+		if u.update.Fields != nil {
+			c.Fields = make(map[string]plan.TextChange, len(u.update.Fields))
+			for name, value := range u.update.Fields {
+				c.Fields[name] = plan.TextChange{Before: u.info.Fields[name].Value, After: value}
+			}
+		}
+		if u.update.Tags != nil {
+			want, have := normalizeTags(u.update.Tags), normalizeTags(u.info.Tags)
+			for _, t := range want {
+				if !slices.Contains(have, t) {
+					c.TagsAdded = append(c.TagsAdded, t)
+				}
+			}
+			for _, t := range have {
+				if !slices.Contains(want, t) {
+					c.TagsRemoved = append(c.TagsRemoved, t)
+				}
+			}
+		}
+		changes = append(changes, c)
+	}
+
+	return changes
+}
+
+// changedNotes fetches the current state of the existing notes and returns
+// updates only for those that differ from the source.
+func (m *Manager) changedNotes(notes []anki.Note, ids []int64, existing []int) ([]pendingUpdate, []int, error) {
+	if len(existing) == 0 {
+		return nil, nil, nil
+	}
+
+	noteIDs := make([]int64, len(existing))
+	for j, i := range existing {
+		noteIDs[j] = ids[i]
+	}
+
+	infos, err := NotesInfo(m.ctx, m.client, noteIDs, m.batchSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byID := make(map[int64]anki.NoteInfo, len(infos))
+	for _, info := range infos {
+		byID[info.NoteID] = info
+	}
+
+	var (
+		updates []pendingUpdate
+		missing []int
+	)
+	for _, i := range existing {
+		info, ok := byID[ids[i]]
+		if !ok {
+			missing = append(missing, i)
+			continue
+		}
+		update := diffNote(notes[i], info)
+		if update.Fields == nil && update.Tags == nil {
+			continue
+		}
+		update.ID = ids[i]
+		updates = append(updates, pendingUpdate{index: i, update: update, info: info})
+	}
+
+	return updates, missing, nil
+}
+
+// diffNote compares a source note with its current state in Anki.
+// The returned update holds only fields whose values differ and the full tag
+// list if the tag sets differ; both are nil when nothing changed.
+func diffNote(note anki.Note, info anki.NoteInfo) anki.NoteUpdate {
+	var update anki.NoteUpdate
+
+	for name, value := range note.Fields {
+		current, ok := info.Fields[name]
+		if ok && current.Value == value {
+			continue
+		}
+		if update.Fields == nil {
+			update.Fields = make(map[string]string)
+		}
+		update.Fields[name] = value
+	}
+
+	if !slices.Equal(normalizeTags(note.Tags), normalizeTags(info.Tags)) {
+		update.Tags = note.Tags
+	}
+
+	return update
+}
+
+// sameContent reports whether a note has the recorded values in all fields
+// but the primary one, at least one of them not empty.
+func sameContent(old state.Note, note anki.Note, primary string) bool {
+	matched := false
+	for name, value := range note.Fields {
+		if name == primary {
+			continue
+		}
+		if !old.FieldSynced(name, value) {
+			return false
+		}
+		matched = matched || value != ""
+	}
+	return matched
+}
+
+func noteKey(deck anki.Deck, note anki.Note) string {
+	return fmt.Sprintf("%s=%q", deck.PrimaryField, note.Fields[deck.PrimaryField])
+}
+
+// normalizeTags returns a sorted set of tags, the way Anki stores them.
+func normalizeTags(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		if t != "" && !slices.Contains(out, t) {
+			out = append(out, t)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
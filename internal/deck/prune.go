@@ -0,0 +1,218 @@
+package deck
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/media"
+	"github.com/spigell/anki-sync/internal/plan"
+)
+
+// PruneMode is what happens to notes that were removed from the sources.
+type PruneMode string
+
+const (
+	PruneDelete  PruneMode = "delete"
+	PruneSuspend PruneMode = "suspend"
+)
+
+// DefaultPruneMax is the default cap of notes removed by a single run.
+const DefaultPruneMax = 50
+
+// WithPrune enables pruning of notes tagged with NoteTag that are no longer
+// present in the sources. The run fails without removing anything if more
+// than limit notes would be pruned; 0 disables the cap.
+func WithPrune(mode PruneMode, limit int) ManagerOption {
+	return func(m *Manager) {
+		m.pruneMode = mode
+		m.pruneMax = limit
+	}
+}
+
+// orphan is a managed note that is gone from the sources.
+type orphan struct {
+	deck string
+	info anki.NoteInfo
+	key  string
+}
+
+// orphans finds notes in the managed decks that carry NoteTag but whose
+// primary field value is not in any source of that deck.
+// Lookups ignore case, as the note search does.
+func (m *Manager) orphans() ([]orphan, error) {
+	type source struct {
+		primaryFields []string
+		values        map[string]bool
+	}
+
+	var names []string
+	sources := make(map[string]*source)
+	for _, deck := range m.data.Decks {
+		src, ok := sources[deck.Deck]
+		if !ok {
+			src = &source{values: make(map[string]bool)}
+			sources[deck.Deck] = src
+			names = append(names, deck.Deck)
+		}
+		if !slices.Contains(src.primaryFields, deck.PrimaryField) {
+			src.primaryFields = append(src.primaryFields, deck.PrimaryField)
+		}
+		// Anki holds the values with media references rewritten to the
+		// stored names, so they are compared the way sync sends them.
+		dir := filepath.Dir(deck.Source)
+		for _, note := range deck.Notes {
+			if resolved, _, err := media.Resolve(dir, note); err == nil {
+				note = resolved
+			}
+			src.values[sourceKey(deck.PrimaryField, note.Fields[deck.PrimaryField])] = true
+		}
+	}
+
+	var orphans []orphan
+	for _, name := range names {
+		src := sources[name]
+
+		// Subdecks are managed by their own sources, if any.
+		query := anki.Search(anki.OnlyDeckSearch(name), anki.TagSearch(NoteTag))
+		if m.pruneMode == PruneSuspend {
+			query = anki.Search(query, anki.Not("is:suspended"))
+		}
+
+		ids, err := m.client.FindNotes(m.ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("error while searching managed notes in deck %s: %w", name, err)
+		}
+		if len(ids) == 0 {
+			continue
+		}
+
+		infos, err := NotesInfo(m.ctx, m.client, ids, m.batchSize)
+		if err != nil {
+			return nil, fmt.Errorf("error while getting managed notes of deck %s: %w", name, err)
+		}
+
+		for _, info := range infos {
+			if info.NoteID == 0 || m.isClaimed(info.NoteID) {
+				continue
+			}
+
+			found := false
+			for _, field := range src.primaryFields {
+				if src.values[sourceKey(field, info.Fields[field].Value)] {
+					found = true
+					break
+				}
+			}
+			if found {
+				continue
+			}
+
+			field := src.primaryFields[0]
+			orphans = append(orphans, orphan{
+				deck: name,
+				info: info,
+				key:  fmt.Sprintf("%s=%q", field, info.Fields[field].Value),
+			})
+		}
+	}
+
+	sort.SliceStable(orphans, func(i, j int) bool { return orphans[i].info.NoteID < orphans[j].info.NoteID })
+	return orphans, nil
+}
+
+func (m *Manager) isClaimed(id int64) bool {
+	m.claimedMu.Lock()
+	defer m.claimedMu.Unlock()
+
+	return m.claimed[id]
+}
+
+// prune deletes or suspends orphaned notes.
+func (m *Manager) prune() error {
+	orphans, err := m.orphans()
+	if err != nil {
+		return err
+	}
+
+	if len(orphans) == 0 {
+		m.logger.Info("nothing to prune")
+		return nil
+	}
+
+	if m.pruneMax > 0 && len(orphans) > m.pruneMax {
+		return fmt.Errorf("refusing to prune %d notes: more than the allowed maximum of %d, raise prune_max to proceed", len(orphans), m.pruneMax)
+	}
+
+	var (
+		noteIDs []int64
+		cardIDs []int64
+	)
+	for _, o := range orphans {
+		l := m.logger.CloneWith(zap.String("deck", o.deck), zap.Int64("noteId", o.info.NoteID), zap.String("note", o.key))
+		if m.dryRun {
+			l.DryRunLogger().Info(fmt.Sprintf("would %s note", m.pruneMode))
+			continue
+		}
+		l.Info(fmt.Sprintf("pruning note (%s)", m.pruneMode))
+		noteIDs = append(noteIDs, o.info.NoteID)
+		cardIDs = append(cardIDs, o.info.Cards...)
+	}
+
+	if m.dryRun {
+		return nil
+	}
+
+	switch m.pruneMode {
+	case PruneDelete:
+		err = m.client.DeleteNotes(m.ctx, noteIDs)
+	case PruneSuspend:
+		err = m.client.SuspendCards(m.ctx, cardIDs)
+	default:
+		err = fmt.Errorf("unknown prune mode %q", m.pruneMode)
+	}
+	if err != nil {
+		return fmt.Errorf("error while pruning notes: %w", err)
+	}
+
+	m.stats.add(Stats{Pruned: len(noteIDs)})
+	return nil
+}
+
+// planPrune adds the notes prune would remove to p.
+func (m *Manager) planPrune(p *plan.Plan) error {
+	orphans, err := m.orphans()
+	if err != nil {
+		return err
+	}
+
+	if m.pruneMax > 0 && len(orphans) > m.pruneMax {
+		p.Errors = append(p.Errors, fmt.Sprintf("%d notes would be pruned, more than the allowed maximum of %d", len(orphans), m.pruneMax))
+	}
+
+	action := plan.Delete
+	if m.pruneMode == PruneSuspend {
+		action = plan.Suspend
+	}
+	for _, o := range orphans {
+		p.Notes = append(p.Notes, plan.NoteChange{
+			Deck:   o.deck,
+			Model:  o.info.ModelName,
+			Action: action,
+			Key:    o.key,
+			NoteID: o.info.NoteID,
+		})
+	}
+	return nil
+}
+
+// sourceKey identifies a primary field value the way lookups compare it:
+// ignoring case and cloze markup.
+func sourceKey(field, value string) string {
+	return field + "\x00" + strings.ToLower(anki.StripCloze(value))
+}
@@ -0,0 +1,53 @@
+package deck
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/spigell/anki-sync/internal/anki"
+)
+
+// Tags returns the tags a note gets in Anki: its own tags, NoteTag and, for
+// notes with an id, the tag holding it.
+func Tags(note anki.Note) []string {
+	tags := append(slices.Clone(note.Tags), NoteTag)
+	if note.ID != "" {
+		tags = append(tags, IDTag(note.ID))
+	}
+	return tags
+}
+
+// IDTag is the tag storing the id of a note in Anki.
+func IDTag(id string) string {
+	return IDTagPrefix + id
+}
+
+// IDFromTags returns the note id stored in tags, if any.
+func IDFromTags(tags []string) string {
+	for _, t := range tags {
+		if id, ok := strings.CutPrefix(t, IDTagPrefix); ok {
+			return id
+		}
+	}
+	return ""
+}
+
+// IsManagedTag reports whether a tag is set by anki-sync rather than taken
+// from the sources.
+func IsManagedTag(tag string) bool {
+	return tag == NoteTag || strings.HasPrefix(tag, IDTagPrefix)
+}
+
+// Lookup is the search finding the note in its deck: the tag holding its id
+// or, for notes without one, its primary field value.
+func Lookup(deck anki.Deck, note anki.Note) anki.NoteSearch {
+	if note.ID != "" {
+		return anki.NoteSearch{Tag: IDTag(note.ID)}
+	}
+	return primaryLookup(deck, note)
+}
+
+func primaryLookup(deck anki.Deck, note anki.Note) anki.NoteSearch {
+	value := note.Fields[deck.PrimaryField]
+	return anki.NoteSearch{Field: deck.PrimaryField, Value: value, Cloze: anki.HasCloze(value)}
+}
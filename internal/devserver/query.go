@@ -0,0 +1,204 @@
+package devserver
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// matcher reports whether a note satisfies a single search term.
+type matcher func(n *Note) bool
+
+// parseQuery compiles the subset of the Anki search syntax that anki-sync
+// issues: space separated terms joined by AND, optionally negated with "-",
+// where a term is one of deck:, tag:, note:, nid:, is:suspended, field:value or plain text.
+// Unlike Anki, is:suspended matches notes whose cards are all suspended.
+// Terms may be double-quoted; `*` matches any sequence and `_` a single character.
+func parseQuery(query string) ([]matcher, error) {
+	terms, err := splitTerms(query)
+	if err != nil {
+		return nil, err
+	}
+
+	matchers := make([]matcher, 0, len(terms))
+	for _, term := range terms {
+		negate := false
+		if strings.HasPrefix(term, "-") && len(term) > 1 {
+			negate = true
+			term = term[1:]
+		}
+
+		m, err := parseTerm(term)
+		if err != nil {
+			return nil, err
+		}
+		if negate {
+			inner := m
+			m = func(n *Note) bool { return !inner(n) }
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+func parseTerm(term string) (matcher, error) {
+	key, value, ok := strings.Cut(term, ":")
+	if !ok {
+		re, err := wildcard("*"+term+"*", true)
+		if err != nil {
+			return nil, err
+		}
+		return func(n *Note) bool {
+			for _, v := range n.Fields {
+				if re.MatchString(v) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+
+	switch strings.ToLower(key) {
+	case "deck":
+		re, err := wildcard(value, true)
+		if err != nil {
+			return nil, err
+		}
+		children, err := wildcard(value+"::*", true)
+		if err != nil {
+			return nil, err
+		}
+		return func(n *Note) bool {
+			return re.MatchString(n.Deck) || children.MatchString(n.Deck)
+		}, nil
+	case "tag":
+		re, err := wildcard(value, true)
+		if err != nil {
+			return nil, err
+		}
+		return func(n *Note) bool {
+			for _, t := range n.Tags {
+				if re.MatchString(t) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case "note":
+		re, err := wildcard(value, true)
+		if err != nil {
+			return nil, err
+		}
+		return func(n *Note) bool { return re.MatchString(n.Model) }, nil
+	case "is":
+		if !strings.EqualFold(value, "suspended") {
+			return nil, fmt.Errorf("unsupported search: is:%s", value)
+		}
+		return func(n *Note) bool { return n.suspended() }, nil
+	case "nid":
+		ids := make(map[int64]bool)
+		for _, raw := range strings.Split(value, ",") {
+			id, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid nid %q", raw)
+			}
+			ids[id] = true
+		}
+		return func(n *Note) bool { return ids[n.ID] }, nil
+	default:
+		re, err := wildcard(value, true)
+		if err != nil {
+			return nil, err
+		}
+		return func(n *Note) bool {
+			for name, v := range n.Fields {
+				if strings.EqualFold(name, key) && re.MatchString(v) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+}
+
+// splitTerms splits a query on unquoted whitespace and strips the quotes.
+func splitTerms(query string) ([]string, error) {
+	var (
+		terms   []string
+		current strings.Builder
+		quoted  bool
+		escaped bool
+		started bool
+	)
+
+	for _, r := range query {
+		switch {
+		case escaped:
+			current.WriteRune('\\')
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+			started = true
+		case r == '"':
+			quoted = !quoted
+			started = true
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if started {
+				terms = append(terms, current.String())
+				current.Reset()
+				started = false
+			}
+		default:
+			current.WriteRune(r)
+			started = true
+		}
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in search: %s", query)
+	}
+	if escaped {
+		current.WriteRune('\\')
+	}
+	if started {
+		terms = append(terms, current.String())
+	}
+	return terms, nil
+}
+
+// wildcard converts an Anki search value into an anchored regular expression.
+// Backslash escapes a following wildcard or special character.
+func wildcard(value string, fold bool) (*regexp.Regexp, error) {
+	var b strings.Builder
+	if fold {
+		b.WriteString("(?is)")
+	} else {
+		b.WriteString("(?s)")
+	}
+	b.WriteString("^")
+
+	escaped := false
+	for _, r := range value {
+		switch {
+		case escaped:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*':
+			b.WriteString(".*")
+		case r == '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escaped {
+		b.WriteString(regexp.QuoteMeta(`\`))
+	}
+	b.WriteString("$")
+
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,900 @@
+// Package devserver emulates the AnkiConnect API on top of a JSON file,
+// so anki-sync can be exercised without a running Anki desktop. It is also
+// the test double behind ankitest, so keep it free of test-only shortcuts.
+package devserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spigell/anki-sync/internal/anki"
+)
+
+// APIVersion is the AnkiConnect API version the server speaks.
+const APIVersion = 6
+
+type action func(params json.RawMessage) (any, error)
+
+// readOnly lists actions that never modify the collection.
+var readOnly = map[string]bool{
+	"version":         true,
+	"modelNames":      true,
+	"modelTemplates":  true,
+	"modelStyling":    true,
+	"modelFieldNames": true,
+	"deckNames":       true,
+	"findNotes":       true,
+	"notesInfo":       true,
+
+	"retrieveMediaFile":  true,
+	"getMediaFilesNames": true,
+}
+
+// Server is an AnkiConnect emulator. Every mutating action is persisted to
+// the state file, if one is configured.
+type Server struct {
+	mu      sync.Mutex
+	path    string
+	state   *State
+	actions map[string]action
+	failing map[string]error
+	srv     *httptest.Server
+}
+
+// New creates a server backed by the state file at path.
+// An empty path keeps the state in memory only.
+func New(path string) (*Server, error) {
+	state := NewState()
+	if path != "" {
+		var err error
+		if state, err = LoadState(path); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &Server{path: path, state: state, failing: make(map[string]error)}
+	s.actions = map[string]action{
+		"multi":                s.multi,
+		"version":              s.version,
+		"modelNames":           s.modelNames,
+		"createModel":          s.createModel,
+		"modelTemplates":       s.modelTemplates,
+		"modelStyling":         s.modelStyling,
+		"modelFieldNames":      s.modelFieldNames,
+		"updateModelTemplates": s.updateModelTemplates,
+		"updateModelStyling":   s.updateModelStyling,
+		"modelFieldAdd":        s.modelFieldAdd,
+		"modelFieldRename":     s.modelFieldRename,
+		"modelFieldRemove":     s.modelFieldRemove,
+		"modelFieldReposition": s.modelFieldReposition,
+		"modelTemplateAdd":     s.modelTemplateAdd,
+		"modelTemplateRename":  s.modelTemplateRename,
+		"modelTemplateRemove":  s.modelTemplateRemove,
+		"deckNames":            s.deckNames,
+		"createDeck":           s.createDeck,
+		"addNote":              s.addNote,
+		"findNotes":            s.findNotes,
+		"notesInfo":            s.notesInfo,
+		"updateNoteFields":     s.updateNoteFields,
+		"updateNoteTags":       s.updateNoteTags,
+		"deleteNotes":          s.deleteNotes,
+		"suspend":              s.suspend,
+		"storeMediaFile":       s.storeMediaFile,
+		"retrieveMediaFile":    s.retrieveMediaFile,
+		"getMediaFilesNames":   s.getMediaFilesNames,
+	}
+	return s, nil
+}
+
+// FailOn makes every call of the given action, including calls nested in
+// `multi`, fail with err. Passing a nil error clears the failure.
+func (s *Server) FailOn(action string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		delete(s.failing, action)
+		return
+	}
+	s.failing[action] = err
+}
+
+// Snapshot returns a deep copy of the current collection.
+func (s *Server) Snapshot() *State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state.clone()
+}
+
+// Start begins serving on addr. An empty addr picks a free loopback port.
+func (s *Server) Start(addr string) error {
+	srv := httptest.NewUnstartedServer(s)
+	if addr != "" {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		srv.Listener.Close()
+		srv.Listener = l
+	}
+	srv.Start()
+	s.srv = srv
+	return nil
+}
+
+// URL returns the base URL of a started server.
+func (s *Server) URL() string {
+	if s.srv == nil {
+		return ""
+	}
+	return s.srv.URL
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	if s.srv != nil {
+		s.srv.Close()
+	}
+}
+
+type request struct {
+	Action  string          `json:"action"`
+	Version int             `json:"version"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type response struct {
+	Result any     `json:"result"`
+	Error  *string `json:"error"`
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// AnkiConnect answers plain GET requests, health checks rely on that.
+	if r.Method != http.MethodPost {
+		fmt.Fprintf(w, "AnkiConnect v.%d", APIVersion)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeResponse(w, nil, err)
+		return
+	}
+
+	result, err := s.handle(req)
+	writeResponse(w, result, err)
+}
+
+func (s *Server) handle(req request) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.dispatch(req)
+	if err != nil {
+		return nil, err
+	}
+	if s.path != "" && !readOnly[req.Action] {
+		if err := s.state.Save(s.path); err != nil {
+			return nil, fmt.Errorf("save state: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// dispatch runs a single action. The caller must hold s.mu.
+func (s *Server) dispatch(req request) (any, error) {
+	act, ok := s.actions[req.Action]
+	if !ok {
+		return nil, apiError("unsupported action")
+	}
+	if err := s.failing[req.Action]; err != nil {
+		return nil, err
+	}
+	return act(req.Params)
+}
+
+func writeResponse(w http.ResponseWriter, result any, err error) {
+	resp := response{Result: result}
+	if err != nil {
+		msg := err.Error()
+		resp.Error = &msg
+		resp.Result = nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func decode(params json.RawMessage, v any) error {
+	if len(params) == 0 {
+		return nil
+	}
+	return json.Unmarshal(params, v)
+}
+
+func (s *Server) multi(params json.RawMessage) (any, error) {
+	var p struct {
+		Actions []request `json:"actions"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+
+	results := make([]response, len(p.Actions))
+	for i, req := range p.Actions {
+		result, err := s.dispatch(req)
+		if err != nil {
+			msg := err.Error()
+			results[i].Error = &msg
+			continue
+		}
+		results[i].Result = result
+	}
+	return results, nil
+}
+
+func (s *Server) version(_ json.RawMessage) (any, error) {
+	return APIVersion, nil
+}
+
+func (s *Server) modelNames(_ json.RawMessage) (any, error) {
+	names := make([]string, 0, len(s.state.Models))
+	for name := range s.state.Models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *Server) createModel(params json.RawMessage) (any, error) {
+	var m anki.Model
+	if err := decode(params, &m); err != nil {
+		return nil, err
+	}
+	if _, ok := s.state.Models[m.Name]; ok {
+		return nil, apiError("Model name already exists")
+	}
+	if len(m.InOrderFields) == 0 {
+		return nil, apiError("Must provide at least one field for inOrderFields")
+	}
+	if len(m.CardTemplates) == 0 {
+		return nil, apiError("Must provide at least one card for cardTemplates")
+	}
+	s.state.Models[m.Name] = m
+	return map[string]any{"name": m.Name, "flds": m.InOrderFields}, nil
+}
+
+func (s *Server) model(params json.RawMessage) (anki.Model, error) {
+	var p struct {
+		ModelName string `json:"modelName"`
+	}
+	if err := decode(params, &p); err != nil {
+		return anki.Model{}, err
+	}
+	m, ok := s.state.Models[p.ModelName]
+	if !ok {
+		return anki.Model{}, apiError("model was not found: %s", p.ModelName)
+	}
+	return m, nil
+}
+
+func (s *Server) modelTemplates(params json.RawMessage) (any, error) {
+	m, err := s.model(params)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]map[string]string, len(m.CardTemplates))
+	for _, t := range m.CardTemplates {
+		result[t.Name] = map[string]string{"Front": t.Front, "Back": t.Back}
+	}
+	return result, nil
+}
+
+func (s *Server) modelStyling(params json.RawMessage) (any, error) {
+	m, err := s.model(params)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"css": m.CSS}, nil
+}
+
+func (s *Server) modelFieldNames(params json.RawMessage) (any, error) {
+	m, err := s.model(params)
+	if err != nil {
+		return nil, err
+	}
+	return m.InOrderFields, nil
+}
+
+func (s *Server) updateModelTemplates(params json.RawMessage) (any, error) {
+	var p struct {
+		Model struct {
+			Name      string                       `json:"name"`
+			Templates map[string]map[string]string `json:"templates"`
+		} `json:"model"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	m, ok := s.state.Models[p.Model.Name]
+	if !ok {
+		return nil, apiError("model was not found: %s", p.Model.Name)
+	}
+
+	// Like AnkiConnect, templates the model does not have are ignored.
+	templates := slices.Clone(m.CardTemplates)
+	for name, sides := range p.Model.Templates {
+		i := slices.IndexFunc(templates, func(t anki.CardTemplate) bool { return t.Name == name })
+		if i < 0 {
+			continue
+		}
+		if front, ok := sides["Front"]; ok {
+			templates[i].Front = front
+		}
+		if back, ok := sides["Back"]; ok {
+			templates[i].Back = back
+		}
+	}
+	m.CardTemplates = templates
+	s.state.Models[m.Name] = m
+	return nil, nil
+}
+
+func (s *Server) updateModelStyling(params json.RawMessage) (any, error) {
+	var p struct {
+		Model struct {
+			Name string `json:"name"`
+			CSS  string `json:"css"`
+		} `json:"model"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	m, ok := s.state.Models[p.Model.Name]
+	if !ok {
+		return nil, apiError("model was not found: %s", p.Model.Name)
+	}
+	m.CSS = p.Model.CSS
+	s.state.Models[m.Name] = m
+	return nil, nil
+}
+
+// fieldParams are the parameters of the modelField* actions.
+type fieldParams struct {
+	ModelName    string `json:"modelName"`
+	FieldName    string `json:"fieldName"`
+	OldFieldName string `json:"oldFieldName"`
+	NewFieldName string `json:"newFieldName"`
+	Index        *int   `json:"index"`
+}
+
+func (s *Server) fieldAction(params json.RawMessage) (fieldParams, anki.Model, error) {
+	var p fieldParams
+	if err := decode(params, &p); err != nil {
+		return p, anki.Model{}, err
+	}
+	m, ok := s.state.Models[p.ModelName]
+	if !ok {
+		return p, anki.Model{}, apiError("model was not found: %s", p.ModelName)
+	}
+	m.InOrderFields = slices.Clone(m.InOrderFields)
+	return p, m, nil
+}
+
+// position clamps a field index the way Anki does.
+func position(index *int, n int) int {
+	if index == nil || *index > n {
+		return n
+	}
+	return max(*index, 0)
+}
+
+func (s *Server) modelFieldAdd(params json.RawMessage) (any, error) {
+	p, m, err := s.fieldAction(params)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(p.FieldName) == "" {
+		return nil, apiError("field name must not be empty")
+	}
+	if slices.Contains(m.InOrderFields, p.FieldName) {
+		return nil, apiError("field already exists: %s", p.FieldName)
+	}
+
+	m.InOrderFields = slices.Insert(m.InOrderFields, position(p.Index, len(m.InOrderFields)), p.FieldName)
+	s.state.Models[m.Name] = m
+	for _, n := range s.state.Notes {
+		if n.Model == m.Name {
+			n.Fields[p.FieldName] = ""
+		}
+	}
+	return nil, nil
+}
+
+func (s *Server) modelFieldRename(params json.RawMessage) (any, error) {
+	p, m, err := s.fieldAction(params)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.Index(m.InOrderFields, p.OldFieldName)
+	if i < 0 {
+		return nil, apiError("field not found: %s", p.OldFieldName)
+	}
+	if strings.TrimSpace(p.NewFieldName) == "" || slices.Contains(m.InOrderFields, p.NewFieldName) {
+		return nil, apiError("invalid field name: %s", p.NewFieldName)
+	}
+
+	m.InOrderFields[i] = p.NewFieldName
+	// Like Anki, references in the templates follow the field.
+	templates := slices.Clone(m.CardTemplates)
+	for j := range templates {
+		templates[j].Front = renameRefs(templates[j].Front, p.OldFieldName, p.NewFieldName)
+		templates[j].Back = renameRefs(templates[j].Back, p.OldFieldName, p.NewFieldName)
+	}
+	m.CardTemplates = templates
+	s.state.Models[m.Name] = m
+	for _, n := range s.state.Notes {
+		if n.Model == m.Name {
+			n.Fields[p.NewFieldName] = n.Fields[p.OldFieldName]
+			delete(n.Fields, p.OldFieldName)
+		}
+	}
+	return nil, nil
+}
+
+func (s *Server) modelFieldRemove(params json.RawMessage) (any, error) {
+	p, m, err := s.fieldAction(params)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.Index(m.InOrderFields, p.FieldName)
+	if i < 0 {
+		return nil, apiError("field not found: %s", p.FieldName)
+	}
+	if len(m.InOrderFields) == 1 {
+		return nil, apiError("a model must have at least one field")
+	}
+
+	m.InOrderFields = slices.Delete(m.InOrderFields, i, i+1)
+	s.state.Models[m.Name] = m
+	for _, n := range s.state.Notes {
+		if n.Model == m.Name {
+			delete(n.Fields, p.FieldName)
+		}
+	}
+	return nil, nil
+}
+
+func (s *Server) modelFieldReposition(params json.RawMessage) (any, error) {
+	p, m, err := s.fieldAction(params)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.Index(m.InOrderFields, p.FieldName)
+	if i < 0 {
+		return nil, apiError("field not found: %s", p.FieldName)
+	}
+
+	m.InOrderFields = slices.Delete(m.InOrderFields, i, i+1)
+	m.InOrderFields = slices.Insert(m.InOrderFields, position(p.Index, len(m.InOrderFields)), p.FieldName)
+	s.state.Models[m.Name] = m
+	return nil, nil
+}
+
+// templateParams are the parameters of the modelTemplate* actions.
+type templateParams struct {
+	ModelName       string            `json:"modelName"`
+	Template        map[string]string `json:"template"`
+	TemplateName    string            `json:"templateName"`
+	OldTemplateName string            `json:"oldTemplateName"`
+	NewTemplateName string            `json:"newTemplateName"`
+}
+
+func (s *Server) templateAction(params json.RawMessage) (templateParams, anki.Model, error) {
+	var p templateParams
+	if err := decode(params, &p); err != nil {
+		return p, anki.Model{}, err
+	}
+	m, ok := s.state.Models[p.ModelName]
+	if !ok {
+		return p, anki.Model{}, apiError("model was not found: %s", p.ModelName)
+	}
+	m.CardTemplates = slices.Clone(m.CardTemplates)
+	return p, m, nil
+}
+
+func templateIndex(m anki.Model, name string) int {
+	return slices.IndexFunc(m.CardTemplates, func(t anki.CardTemplate) bool { return t.Name == name })
+}
+
+// modelTemplateAdd appends a template and, as cards exist per template, a
+// card to every note of the model.
+func (s *Server) modelTemplateAdd(params json.RawMessage) (any, error) {
+	p, m, err := s.templateAction(params)
+	if err != nil {
+		return nil, err
+	}
+	t := anki.CardTemplate{Name: p.Template["Name"], Front: p.Template["Front"], Back: p.Template["Back"]}
+	if strings.TrimSpace(t.Name) == "" {
+		return nil, apiError("template name must not be empty")
+	}
+	if templateIndex(m, t.Name) >= 0 {
+		return nil, apiError("template already exists: %s", t.Name)
+	}
+
+	m.CardTemplates = append(m.CardTemplates, t)
+	s.state.Models[m.Name] = m
+	for _, n := range s.state.Notes {
+		if n.Model == m.Name {
+			n.Cards = append(n.Cards, Card{ID: s.state.NextID})
+			s.state.NextID++
+		}
+	}
+	return nil, nil
+}
+
+func (s *Server) modelTemplateRename(params json.RawMessage) (any, error) {
+	p, m, err := s.templateAction(params)
+	if err != nil {
+		return nil, err
+	}
+	i := templateIndex(m, p.OldTemplateName)
+	if i < 0 {
+		return nil, apiError("template not found: %s", p.OldTemplateName)
+	}
+	if strings.TrimSpace(p.NewTemplateName) == "" || templateIndex(m, p.NewTemplateName) >= 0 {
+		return nil, apiError("invalid template name: %s", p.NewTemplateName)
+	}
+
+	m.CardTemplates[i].Name = p.NewTemplateName
+	s.state.Models[m.Name] = m
+	return nil, nil
+}
+
+// modelTemplateRemove deletes a template with its cards. Like Anki, it refuses
+// to remove the last template.
+func (s *Server) modelTemplateRemove(params json.RawMessage) (any, error) {
+	p, m, err := s.templateAction(params)
+	if err != nil {
+		return nil, err
+	}
+	i := templateIndex(m, p.TemplateName)
+	if i < 0 {
+		return nil, apiError("template not found: %s", p.TemplateName)
+	}
+	if len(m.CardTemplates) == 1 {
+		return nil, apiError("a model must have at least one template")
+	}
+
+	m.CardTemplates = slices.Delete(m.CardTemplates, i, i+1)
+	s.state.Models[m.Name] = m
+	for _, n := range s.state.Notes {
+		if n.Model == m.Name && i < len(n.Cards) {
+			n.Cards = slices.Delete(n.Cards, i, i+1)
+		}
+	}
+	return nil, nil
+}
+
+// renameRefs renames the references to a field in a card template.
+func renameRefs(template, oldName, newName string) string {
+	re := regexp.MustCompile(`\{\{([#^/]?)((?:[^{}:]+:)*)` + regexp.QuoteMeta(oldName) + `\}\}`)
+	return re.ReplaceAllString(template, "{{${1}${2}"+strings.ReplaceAll(newName, "$", "$$")+"}}")
+}
+
+func (s *Server) deckNames(_ json.RawMessage) (any, error) {
+	return slices.Clone(s.state.Decks), nil
+}
+
+func (s *Server) createDeck(params json.RawMessage) (any, error) {
+	var p struct {
+		Deck string `json:"deck"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(p.Deck) == "" {
+		return nil, apiError("deck name must not be empty")
+	}
+	s.state.addDeck(p.Deck)
+	return slices.Index(s.state.Decks, p.Deck) + 1, nil
+}
+
+func (s *Server) addNote(params json.RawMessage) (any, error) {
+	var p struct {
+		Note struct {
+			DeckName  string            `json:"deckName"`
+			ModelName string            `json:"modelName"`
+			Fields    map[string]string `json:"fields"`
+			Tags      []string          `json:"tags"`
+			Options   struct {
+				AllowDuplicate bool `json:"allowDuplicate"`
+			} `json:"options"`
+		} `json:"note"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	in := p.Note
+
+	m, ok := s.state.Models[in.ModelName]
+	if !ok {
+		return nil, apiError("model was not found: %s", in.ModelName)
+	}
+	if !s.state.hasDeck(in.DeckName) {
+		return nil, apiError("deck was not found: %s", in.DeckName)
+	}
+
+	fields := make(map[string]string, len(m.InOrderFields))
+	for _, name := range m.InOrderFields {
+		fields[name] = in.Fields[name]
+	}
+	for name := range in.Fields {
+		if _, ok := fields[name]; !ok {
+			return nil, apiError("%q is not a field of model %q", name, m.Name)
+		}
+	}
+
+	first := m.InOrderFields[0]
+	if strings.TrimSpace(fields[first]) == "" {
+		return nil, apiError("cannot create note because it is empty")
+	}
+	if !in.Options.AllowDuplicate {
+		for _, n := range s.state.Notes {
+			if n.Model == m.Name && n.Fields[first] == fields[first] {
+				return nil, apiError("cannot create note because it is a duplicate")
+			}
+		}
+	}
+
+	n := &Note{
+		ID:     s.state.NextID,
+		Deck:   in.DeckName,
+		Model:  m.Name,
+		Fields: fields,
+		Tags:   normalizeTags(in.Tags),
+		Mod:    time.Now().Unix(),
+	}
+	s.state.NextID++
+	for range m.CardTemplates {
+		n.Cards = append(n.Cards, Card{ID: s.state.NextID})
+		s.state.NextID++
+	}
+	s.state.Notes = append(s.state.Notes, n)
+	return n.ID, nil
+}
+
+func (s *Server) findNotes(params json.RawMessage) (any, error) {
+	var p struct {
+		Query string `json:"query"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+
+	matchers, err := parseQuery(p.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0)
+	for _, n := range s.state.Notes {
+		if matchAll(n, matchers) {
+			ids = append(ids, n.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (s *Server) notesInfo(params json.RawMessage) (any, error) {
+	var p struct {
+		Notes []int64 `json:"notes"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+
+	infos := make([]any, 0, len(p.Notes))
+	for _, id := range p.Notes {
+		n, ok := s.state.note(id)
+		if !ok {
+			// AnkiConnect returns an empty object for unknown notes.
+			infos = append(infos, struct{}{})
+			continue
+		}
+
+		fields := make(map[string]anki.NoteInfoField, len(n.Fields))
+		for i, name := range s.state.Models[n.Model].InOrderFields {
+			fields[name] = anki.NoteInfoField{Value: n.Fields[name], Order: i}
+		}
+		infos = append(infos, anki.NoteInfo{
+			NoteID:    n.ID,
+			ModelName: n.Model,
+			Tags:      slices.Clone(n.Tags),
+			Fields:    fields,
+			Cards:     cardIDs(n),
+			Mod:       n.Mod,
+		})
+	}
+	return infos, nil
+}
+
+func cardIDs(n *Note) []int64 {
+	ids := make([]int64, 0, len(n.Cards))
+	for _, c := range n.Cards {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
+
+func (s *Server) deleteNotes(params json.RawMessage) (any, error) {
+	var p struct {
+		Notes []int64 `json:"notes"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	s.state.Notes = slices.DeleteFunc(s.state.Notes, func(n *Note) bool {
+		return slices.Contains(p.Notes, n.ID)
+	})
+	return nil, nil
+}
+
+func (s *Server) suspend(params json.RawMessage) (any, error) {
+	var p struct {
+		Cards []int64 `json:"cards"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+
+	changed := false
+	for _, n := range s.state.Notes {
+		for i := range n.Cards {
+			if slices.Contains(p.Cards, n.Cards[i].ID) && !n.Cards[i].Suspended {
+				n.Cards[i].Suspended = true
+				changed = true
+			}
+		}
+	}
+	return changed, nil
+}
+
+func (s *Server) storeMediaFile(params json.RawMessage) (any, error) {
+	var p struct {
+		Filename       string `json:"filename"`
+		Data           []byte `json:"data"`
+		DeleteExisting *bool  `json:"deleteExisting"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Filename == "" || strings.ContainsAny(p.Filename, `/\`) {
+		return nil, apiError("invalid media filename: %s", p.Filename)
+	}
+
+	name := p.Filename
+	// Like Anki, keep the existing file and store a renamed copy when asked to.
+	if _, exists := s.state.Media[name]; exists && p.DeleteExisting != nil && !*p.DeleteExisting {
+		ext := path.Ext(name)
+		stem := strings.TrimSuffix(name, ext)
+		for i := 1; ; i++ {
+			candidate := fmt.Sprintf("%s-%d%s", stem, i, ext)
+			if _, taken := s.state.Media[candidate]; !taken {
+				name = candidate
+				break
+			}
+		}
+	}
+
+	s.state.Media[name] = p.Data
+	return name, nil
+}
+
+func (s *Server) retrieveMediaFile(params json.RawMessage) (any, error) {
+	var p struct {
+		Filename string `json:"filename"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	data, ok := s.state.Media[p.Filename]
+	if !ok {
+		return false, nil
+	}
+	return data, nil
+}
+
+func (s *Server) getMediaFilesNames(params json.RawMessage) (any, error) {
+	p := struct {
+		Pattern string `json:"pattern"`
+	}{Pattern: "*"}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	for name := range s.state.Media {
+		ok, err := path.Match(p.Pattern, name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func matchAll(n *Note, matchers []matcher) bool {
+	for _, m := range matchers {
+		if !m(n) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) updateNoteFields(params json.RawMessage) (any, error) {
+	var p struct {
+		Note struct {
+			ID     int64             `json:"id"`
+			Fields map[string]string `json:"fields"`
+		} `json:"note"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	n, ok := s.state.note(p.Note.ID)
+	if !ok {
+		return nil, apiError("Note was not found: %d", p.Note.ID)
+	}
+	for name, value := range p.Note.Fields {
+		if _, ok := n.Fields[name]; !ok {
+			return nil, apiError("%q is not a field of model %q", name, n.Model)
+		}
+		n.Fields[name] = value
+	}
+	n.Mod = time.Now().Unix()
+	return nil, nil
+}
+
+func (s *Server) updateNoteTags(params json.RawMessage) (any, error) {
+	var p struct {
+		Note int64    `json:"note"`
+		Tags []string `json:"tags"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	n, ok := s.state.note(p.Note)
+	if !ok {
+		return nil, apiError("Note was not found: %d", p.Note)
+	}
+	n.Tags = normalizeTags(p.Tags)
+	n.Mod = time.Now().Unix()
+	return nil, nil
+}
+
+// apiError builds an error carrying AnkiConnect's own message verbatim.
+func apiError(format string, args ...any) error {
+	return fmt.Errorf(format, args...)
+}
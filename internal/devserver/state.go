@@ -0,0 +1,209 @@
+package devserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/spigell/anki-sync/internal/anki"
+)
+
+// State is the emulated Anki collection. It is persisted as JSON between runs.
+type State struct {
+	NextID int64                 `json:"next_id"`
+	Decks  []string              `json:"decks"`
+	Models map[string]anki.Model `json:"models"`
+	Notes  []*Note               `json:"notes"`
+	Media  map[string][]byte     `json:"media"`
+}
+
+// Note is a note of the emulated collection.
+type Note struct {
+	ID     int64             `json:"id"`
+	Deck   string            `json:"deck"`
+	Model  string            `json:"model"`
+	Fields map[string]string `json:"fields"`
+	Tags   []string          `json:"tags"`
+	Mod    int64             `json:"mod"`
+	Cards  []Card            `json:"cards"`
+}
+
+// Card is a card generated for a note, one per card template.
+type Card struct {
+	ID        int64 `json:"id"`
+	Suspended bool  `json:"suspended"`
+}
+
+// suspended reports whether all cards of the note are suspended.
+func (n *Note) suspended() bool {
+	if len(n.Cards) == 0 {
+		return false
+	}
+	for _, c := range n.Cards {
+		if !c.Suspended {
+			return false
+		}
+	}
+	return true
+}
+
+// NewState returns a collection resembling a fresh Anki profile:
+// the "Default" deck and the stock "Basic" and "Cloze" note types.
+func NewState() *State {
+	return &State{
+		NextID: 1,
+		Decks:  []string{"Default"},
+		Media:  make(map[string][]byte),
+		Models: map[string]anki.Model{
+			"Basic": {
+				Name:          "Basic",
+				InOrderFields: []string{"Front", "Back"},
+				CSS:           defaultCSS,
+				CardTemplates: []anki.CardTemplate{{
+					Name:  "Card 1",
+					Front: "{{Front}}",
+					Back:  "{{FrontSide}}\n\n<hr id=answer>\n\n{{Back}}",
+				}},
+			},
+			"Cloze": {
+				Name:          "Cloze",
+				InOrderFields: []string{"Text", "Back Extra"},
+				CSS:           defaultCSS,
+				IsCloze:       true,
+				CardTemplates: []anki.CardTemplate{{
+					Name:  "Cloze",
+					Front: "{{cloze:Text}}",
+					Back:  "{{cloze:Text}}<br>\n{{Back Extra}}",
+				}},
+			},
+		},
+	}
+}
+
+const defaultCSS = `.card {
+    font-family: arial;
+    font-size: 20px;
+    text-align: center;
+    color: black;
+    background-color: white;
+}
+`
+
+// LoadState reads a state file. A missing file yields a fresh collection.
+func LoadState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewState(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &State{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("parse state file %s: %w", path, err)
+	}
+	if s.Models == nil {
+		s.Models = make(map[string]anki.Model)
+	}
+	if s.Media == nil {
+		s.Media = make(map[string][]byte)
+	}
+	if s.NextID < 1 {
+		s.NextID = 1
+	}
+	return s, nil
+}
+
+// Save writes the state to path atomically.
+func (s *State) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *State) clone() *State {
+	c := &State{
+		NextID: s.NextID,
+		Decks:  slices.Clone(s.Decks),
+		Models: make(map[string]anki.Model, len(s.Models)),
+		Notes:  make([]*Note, 0, len(s.Notes)),
+		Media:  make(map[string][]byte, len(s.Media)),
+	}
+	for name, data := range s.Media {
+		c.Media[name] = slices.Clone(data)
+	}
+	for name, m := range s.Models {
+		m.InOrderFields = slices.Clone(m.InOrderFields)
+		m.CardTemplates = slices.Clone(m.CardTemplates)
+		c.Models[name] = m
+	}
+	for _, n := range s.Notes {
+		nc := *n
+		nc.Fields = maps.Clone(n.Fields)
+		nc.Tags = slices.Clone(n.Tags)
+		nc.Cards = slices.Clone(n.Cards)
+		c.Notes = append(c.Notes, &nc)
+	}
+	return c
+}
+
+func (s *State) hasDeck(name string) bool {
+	return slices.Contains(s.Decks, name)
+}
+
+func (s *State) addDeck(name string) {
+	// Anki creates missing parents of nested decks as well.
+	parts := strings.Split(name, "::")
+	for i := range parts {
+		if d := strings.Join(parts[:i+1], "::"); !s.hasDeck(d) {
+			s.Decks = append(s.Decks, d)
+		}
+	}
+	sort.Strings(s.Decks)
+}
+
+func (s *State) note(id int64) (*Note, bool) {
+	for _, n := range s.Notes {
+		if n.ID == id {
+			return n, true
+		}
+	}
+	return nil, false
+}
+
+// normalizeTags deduplicates and sorts tags as Anki does when saving a note.
+func normalizeTags(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		for _, part := range strings.Fields(t) {
+			if !slices.Contains(out, part) {
+				out = append(out, part)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,437 @@
+// Package export turns decks built in Anki into anki-sync sources.
+package export
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/deck"
+	"github.com/spigell/anki-sync/internal/logging"
+	"github.com/spigell/anki-sync/internal/parser"
+)
+
+const (
+	// ModelsFile is the name of the models file written next to the decks directory.
+	ModelsFile = "models.yaml"
+	// DecksDir is the directory deck files are written to.
+	DecksDir = "decks"
+)
+
+// Exporter reads decks and models from Anki.
+type Exporter struct {
+	ctx    context.Context
+	client anki.Connector
+	logger *logging.Logger
+
+	models map[string]anki.Model
+	// untagged are notes that don't carry deck.NoteTag yet.
+	untagged []anki.NoteUpdate
+}
+
+func NewExporter(ctx context.Context, client anki.Connector, logger *logging.Logger) *Exporter {
+	return &Exporter{
+		ctx:    ctx,
+		client: client,
+		logger: logger,
+		models: make(map[string]anki.Model),
+	}
+}
+
+// DeckNames returns the decks holding at least one note.
+func (e *Exporter) DeckNames() ([]string, error) {
+	names, err := e.client.DeckNames(e.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for _, name := range names {
+		ids, err := e.client.FindNotes(e.ctx, anki.OnlyDeckSearch(name))
+		if err != nil {
+			return nil, fmt.Errorf("error while searching notes in deck %s: %w", name, err)
+		}
+		if len(ids) > 0 {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// Deck returns the notes of a deck, without its subdecks. The anki-sync
+// schema allows a single model per deck file, so a deck mixing models is
+// returned as one anki.Deck per model.
+// The primary field of every deck is the first field of its model.
+func (e *Exporter) Deck(name string) ([]anki.Deck, error) {
+	ids, err := e.client.FindNotes(e.ctx, anki.OnlyDeckSearch(name))
+	if err != nil {
+		return nil, fmt.Errorf("error while searching notes in deck %s: %w", name, err)
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("deck %s has no notes", name)
+	}
+
+	infos, err := deck.NotesInfo(e.ctx, e.client, ids, deck.DefaultBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting notes of deck %s: %w", name, err)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].NoteID < infos[j].NoteID })
+
+	var (
+		decks  []anki.Deck
+		byName = make(map[string]int)
+	)
+	for _, info := range infos {
+		model, err := e.model(info.ModelName)
+		if err != nil {
+			return nil, err
+		}
+
+		i, ok := byName[model.Name]
+		if !ok {
+			i = len(decks)
+			byName[model.Name] = i
+			decks = append(decks, anki.Deck{
+				Deck:         name,
+				Model:        model.Name,
+				PrimaryField: model.InOrderFields[0],
+			})
+		}
+
+		note := anki.Note{
+			ID:     deck.IDFromTags(info.Tags),
+			Fields: make(map[string]string, len(info.Fields)),
+			Tags:   []string{},
+		}
+		for field, v := range info.Fields {
+			note.Fields[field] = v.Value
+		}
+		for _, t := range info.Tags {
+			if !deck.IsManagedTag(t) {
+				note.Tags = append(note.Tags, t)
+			}
+		}
+		if !slices.Contains(info.Tags, deck.NoteTag) {
+			e.untagged = append(e.untagged, anki.NoteUpdate{ID: info.NoteID, Tags: append(slices.Clone(info.Tags), deck.NoteTag)})
+		}
+		decks[i].Notes = append(decks[i].Notes, note)
+	}
+
+	for _, d := range decks {
+		e.warnUnsyncable(d)
+	}
+	return decks, nil
+}
+
+// Models returns the definitions of the models used by the exported decks.
+func (e *Exporter) Models() []anki.Model {
+	models := make([]anki.Model, 0, len(e.models))
+	for _, m := range e.models {
+		models = append(models, m)
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].Name < models[j].Name })
+	return models
+}
+
+// Adopt tags the exported notes with deck.NoteTag, so that the next sync
+// recognizes them as managed and has nothing to change.
+func (e *Exporter) Adopt() error {
+	if len(e.untagged) == 0 {
+		return nil
+	}
+
+	errs, err := e.client.UpdateNotes(e.ctx, e.untagged)
+	if err != nil {
+		return fmt.Errorf("error while tagging exported notes: %w", err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("error while tagging exported notes: %w", err)
+	}
+
+	e.logger.Info("exported notes tagged", zap.Int("notes", len(e.untagged)), zap.String("tag", deck.NoteTag))
+	e.untagged = nil
+	return nil
+}
+
+func (e *Exporter) model(name string) (anki.Model, error) {
+	if m, ok := e.models[name]; ok {
+		return m, nil
+	}
+
+	fields, err := e.client.GetModelFieldNames(e.ctx, name)
+	if err != nil {
+		return anki.Model{}, fmt.Errorf("get fields of model %s: %w", name, err)
+	}
+	if len(fields) == 0 {
+		return anki.Model{}, fmt.Errorf("model %s has no fields", name)
+	}
+	templates, err := e.client.GetModelTemplates(e.ctx, name)
+	if err != nil {
+		return anki.Model{}, fmt.Errorf("get templates of model %s: %w", name, err)
+	}
+	css, err := e.client.GetModelStyling(e.ctx, name)
+	if err != nil {
+		return anki.Model{}, fmt.Errorf("get styling of model %s: %w", name, err)
+	}
+
+	m := anki.Model{
+		Name:          name,
+		InOrderFields: fields,
+		CSS:           css,
+		CardTemplates: templates,
+	}
+	m.IsCloze = parser.IsCloze(m)
+
+	e.models[name] = m
+	return m, nil
+}
+
+// warnUnsyncable reports notes that validation would reject, as Anki allows
+// an empty or duplicate first field while anki-sync relies on it as a key.
+func (e *Exporter) warnUnsyncable(d anki.Deck) {
+	seen := make(map[string]bool, len(d.Notes))
+	for _, n := range d.Notes {
+		value := strings.TrimSpace(n.Fields[d.PrimaryField])
+		switch {
+		case value == "":
+			e.logger.Warn("exported note has an empty primary field", zap.String("deck", d.Deck), zap.String("primary_field", d.PrimaryField))
+		case seen[value]:
+			e.logger.Warn("exported notes share a primary field value", zap.String("deck", d.Deck), zap.String("primary_field", d.PrimaryField), zap.String("value", value))
+		}
+		seen[value] = true
+	}
+}
+
+// Marshal encodes a deck in the anki-sync schema with note fields in the
+// order of the model.
+func Marshal(d anki.Deck, model anki.Model) ([]byte, error) {
+	var doc yaml.Node
+	if err := doc.Encode(d); err != nil {
+		return nil, err
+	}
+
+	order := make(map[string]int, len(model.InOrderFields))
+	for i, f := range model.InOrderFields {
+		order[f] = i
+	}
+
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value != "notes" {
+			continue
+		}
+		for _, note := range doc.Content[i+1].Content {
+			for j := 0; j+1 < len(note.Content); j += 2 {
+				if note.Content[j].Value == "fields" {
+					sortMapping(note.Content[j+1], order)
+				}
+			}
+		}
+	}
+
+	return encode(&doc)
+}
+
+// encode marshals v with the indentation used throughout the examples.
+func encode(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sortMapping reorders the entries of a mapping node by the given key order.
+func sortMapping(n *yaml.Node, order map[string]int) {
+	type pair struct{ key, value *yaml.Node }
+	pairs := make([]pair, 0, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		pairs = append(pairs, pair{n.Content[i], n.Content[i+1]})
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return order[pairs[i].key.Value] < order[pairs[j].key.Value] })
+
+	n.Content = n.Content[:0]
+	for _, p := range pairs {
+		n.Content = append(n.Content, p.key, p.value)
+	}
+}
+
+// Write stores decks under dir/decks, one file per deck and model, and merges
+// their models into dir/models.yaml. It returns the paths written.
+func Write(dir string, decks []anki.Deck, models []anki.Model) ([]string, error) {
+	byName := make(map[string]anki.Model, len(models))
+	for _, m := range models {
+		byName[m.Name] = m
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, DecksDir), 0o755); err != nil {
+		return nil, err
+	}
+
+	var written []string
+	for _, d := range decks {
+		data, err := Marshal(d, byName[d.Model])
+		if err != nil {
+			return nil, fmt.Errorf("encode deck %s: %w", d.Deck, err)
+		}
+		path := filepath.Join(dir, DecksDir, FileName(d, decks))
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return nil, err
+		}
+		written = append(written, path)
+	}
+
+	path := filepath.Join(dir, ModelsFile)
+	if err := writeModels(path, models); err != nil {
+		return nil, err
+	}
+	return append(written, path), nil
+}
+
+// Split stores the CSS and templates of m as files under dir/<model> and adds
+// the model, referring to them, to dir/models.yaml. It returns the paths written.
+func Split(dir string, m anki.Model) ([]string, error) {
+	sub := slug(m.Name)
+	if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+		return nil, err
+	}
+
+	var written []string
+	write := func(name, text string) (string, error) {
+		rel := filepath.ToSlash(filepath.Join(sub, name))
+		path := filepath.Join(dir, rel)
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			return "", err
+		}
+		written = append(written, path)
+		return rel, nil
+	}
+
+	var err error
+	if m.CSS != "" {
+		if m.CSSFile, err = write("style.css", m.CSS); err != nil {
+			return nil, err
+		}
+		m.CSS = ""
+	}
+
+	templates := make([]anki.CardTemplate, len(m.CardTemplates))
+	for i, t := range m.CardTemplates {
+		if t.FrontFile, err = write(slug(t.Name)+".front.html", t.Front); err != nil {
+			return nil, err
+		}
+		if t.BackFile, err = write(slug(t.Name)+".back.html", t.Back); err != nil {
+			return nil, err
+		}
+		t.Front, t.Back = "", ""
+		templates[i] = t
+	}
+	m.CardTemplates = templates
+
+	path := filepath.Join(dir, ModelsFile)
+	if err := writeModels(path, []anki.Model{m}); err != nil {
+		return nil, err
+	}
+	return append(written, path), nil
+}
+
+// writeModels adds models to the models file, replacing the ones with the same
+// name. Other models are kept as written, with their file references.
+func writeModels(path string, models []anki.Model) error {
+	var doc yaml.Node
+	if data, err := os.ReadFile(path); err == nil {
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("failed to parse models: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	if len(doc.Content) > 0 && doc.Content[0].Kind == yaml.MappingNode {
+		root = doc.Content[0]
+	}
+	list := modelList(root)
+
+	for _, m := range models {
+		var n yaml.Node
+		if err := n.Encode(m); err != nil {
+			return fmt.Errorf("encode model %s: %w", m.Name, err)
+		}
+		i := slices.IndexFunc(list.Content, func(e *yaml.Node) bool { return modelName(e) == m.Name })
+		if i >= 0 {
+			list.Content[i] = &n
+			continue
+		}
+		list.Content = append(list.Content, &n)
+	}
+
+	data, err := encode(root)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// modelList returns the models sequence of a models file, adding it if missing.
+func modelList(root *yaml.Node) *yaml.Node {
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "models" && root.Content[i+1].Kind == yaml.SequenceNode {
+			return root.Content[i+1]
+		}
+	}
+	list := &yaml.Node{Kind: yaml.SequenceNode}
+	root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "models"}, list)
+	return list
+}
+
+// modelName returns the name of a model node.
+func modelName(n *yaml.Node) string {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == "name" {
+			return n.Content[i+1].Value
+		}
+	}
+	return ""
+}
+
+// FileName is the deck file name for d. Decks are named after the Anki deck,
+// with the model appended when other decks in all share the name.
+func FileName(d anki.Deck, all []anki.Deck) string {
+	name := d.Deck
+	for _, o := range all {
+		if o.Deck == d.Deck && o.Model != d.Model {
+			name += "." + d.Model
+			break
+		}
+	}
+	return slug(name) + ".yaml"
+}
+
+func slug(s string) string {
+	s = strings.ReplaceAll(s, "::", "__")
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,138 @@
+package export_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/anki/ankitest"
+	"github.com/spigell/anki-sync/internal/deck"
+	"github.com/spigell/anki-sync/internal/export"
+	"github.com/spigell/anki-sync/internal/logging"
+	"github.com/spigell/anki-sync/internal/model"
+	"github.com/spigell/anki-sync/internal/parser"
+	"github.com/spigell/anki-sync/internal/plan"
+)
+
+func testLogger() *logging.Logger {
+	return &logging.Logger{Logger: zap.NewNop()}
+}
+
+// A deck and its subdeck hold notes sharing a primary field value, so
+// that a lookup spanning subdecks would find both.
+func collection(t *testing.T) *ankitest.Fake {
+	t.Helper()
+	ctx := context.Background()
+	fake := ankitest.NewFake()
+
+	// The emulator, like Anki, rejects a duplicate first field within a
+	// model, so the subdeck uses a copy of Basic.
+	basic, _ := fake.Model("Basic")
+	copied := basic
+	copied.Name = "Basic copy"
+	if err := fake.CreateModel(ctx, copied); err != nil {
+		t.Fatalf("CreateModel() error = %v", err)
+	}
+
+	add := func(deckName, modelName string, notes ...anki.Note) {
+		if err := fake.CreateDeck(ctx, deckName); err != nil {
+			t.Fatalf("CreateDeck() error = %v", err)
+		}
+		if _, err := fake.AddNotes(ctx, deckName, modelName, notes); err != nil {
+			t.Fatalf("AddNotes() error = %v", err)
+		}
+	}
+	add("Lang", "Basic",
+		anki.Note{Fields: map[string]string{"Front": "cat", "Back": "кошка"}, Tags: []string{"animals"}},
+		anki.Note{Fields: map[string]string{"Front": "dog", "Back": "собака"}},
+	)
+	add("Lang::Sub", "Basic copy",
+		anki.Note{Fields: map[string]string{"Front": "cat", "Back": "кот"}},
+	)
+	return fake
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	fake := collection(t)
+
+	exporter := export.NewExporter(ctx, fake, testLogger())
+	names, err := exporter.DeckNames()
+	if err != nil {
+		t.Fatalf("DeckNames() error = %v", err)
+	}
+	var decks []anki.Deck
+	for _, name := range names {
+		d, err := exporter.Deck(name)
+		if err != nil {
+			t.Fatalf("Deck(%q) error = %v", name, err)
+		}
+		decks = append(decks, d...)
+	}
+	if len(decks) != 2 || len(decks[0].Notes) != 2 || len(decks[1].Notes) != 1 {
+		t.Fatalf("exported decks = %+v, want Lang with 2 notes and Lang::Sub with 1", decks)
+	}
+
+	dir := t.TempDir()
+	if _, err := export.Write(dir, decks, exporter.Models()); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := exporter.Adopt(); err != nil {
+		t.Fatalf("Adopt() error = %v", err)
+	}
+
+	models, err := parser.LoadModels(filepath.Join(dir, export.ModelsFile), false)
+	if err != nil {
+		t.Fatalf("LoadModels() error = %v", err)
+	}
+	parsed, err := parser.LoadDecks(filepath.Join(dir, export.DecksDir), false)
+	if err != nil {
+		t.Fatalf("LoadDecks() error = %v", err)
+	}
+	data := &anki.Data{Models: models}
+	for _, d := range parsed {
+		data.Decks = append(data.Decks, d.Deck)
+	}
+
+	p := &plan.Plan{}
+	if err := model.NewModelManager(ctx, fake, true, testLogger(), data).Plan(p); err != nil {
+		t.Fatalf("model Plan() error = %v", err)
+	}
+	if err := deck.NewDeckManager(ctx, fake, true, testLogger(), data).Plan(p); err != nil {
+		t.Fatalf("deck Plan() error = %v", err)
+	}
+	if !p.Empty() {
+		t.Errorf("Plan() after export = %+v, want no changes", p)
+	}
+
+	m := deck.NewDeckManager(ctx, fake, false, testLogger(), data, deck.WithNoteUploadParallelism(2))
+	if err := m.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got, want := m.Stats(), (deck.Stats{Unchanged: 3}); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestExportWithoutAdopt(t *testing.T) {
+	ctx := context.Background()
+	fake := collection(t)
+
+	exporter := export.NewExporter(ctx, fake, testLogger())
+	decks, err := exporter.Deck("Lang")
+	if err != nil {
+		t.Fatalf("Deck() error = %v", err)
+	}
+
+	// Without the tag the notes are found but not yet managed.
+	m := deck.NewDeckManager(ctx, fake, false, testLogger(), &anki.Data{Decks: decks}, deck.WithNoteUploadParallelism(2))
+	if err := m.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got, want := m.Stats(), (deck.Stats{Updated: 2}); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
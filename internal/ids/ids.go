@@ -0,0 +1,134 @@
+// Package ids gives the notes of deck files stable ids.
+package ids
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/spigell/anki-sync/internal/anki"
+)
+
+// idLen is the number of random bytes in a generated id.
+const idLen = 6
+
+// Assignment is an id given to a note.
+type Assignment struct {
+	Path string
+	Line int
+	Deck string
+	// Key is the primary field value of the note.
+	Key string
+	ID  string
+}
+
+// Assign gives an id to every note of the decks that has none. Generated ids
+// are unique among the ids of decks with the same name. Unless dryRun is set,
+// the ids are written to the deck files, keeping comments and key order.
+func Assign(decks []anki.Deck, dryRun bool) ([]Assignment, error) {
+	used := make(map[string]map[string]bool)
+	for _, d := range decks {
+		if used[d.Deck] == nil {
+			used[d.Deck] = make(map[string]bool)
+		}
+		for _, n := range d.Notes {
+			if n.ID != "" {
+				used[d.Deck][n.ID] = true
+			}
+		}
+	}
+
+	var assigned []Assignment
+	for _, d := range decks {
+		ids := make(map[int]string)
+		for i, n := range d.Notes {
+			if n.ID != "" {
+				continue
+			}
+			id, err := generate(used[d.Deck])
+			if err != nil {
+				return nil, err
+			}
+			used[d.Deck][id] = true
+			ids[i] = id
+			assigned = append(assigned, Assignment{Path: d.Source, Line: n.Line, Deck: d.Deck, Key: n.Fields[d.PrimaryField], ID: id})
+		}
+
+		if dryRun || len(ids) == 0 {
+			continue
+		}
+		if err := write(d.Source, ids); err != nil {
+			return nil, fmt.Errorf("error while writing %s: %w", d.Source, err)
+		}
+	}
+	return assigned, nil
+}
+
+func generate(used map[string]bool) (string, error) {
+	b := make([]byte, idLen)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		if id := hex.EncodeToString(b); !used[id] {
+			return id, nil
+		}
+	}
+}
+
+// write adds an id key in front of the notes at the given indexes.
+func write(path string, ids map[int]string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return err
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("empty document")
+	}
+
+	var notes *yaml.Node
+	doc := root.Content[0]
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value == "notes" {
+			notes = doc.Content[i+1]
+		}
+	}
+	if notes == nil || notes.Kind != yaml.SequenceNode {
+		return fmt.Errorf("no notes")
+	}
+
+	for i, id := range ids {
+		if i >= len(notes.Content) || notes.Content[i].Kind != yaml.MappingNode {
+			return fmt.Errorf("note %d not found", i+1)
+		}
+		note := notes.Content[i]
+		note.Content = append([]*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: "id"},
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: id, Style: yaml.DoubleQuotedStyle},
+		}, note.Content...)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&root); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), info.Mode().Perm())
+}
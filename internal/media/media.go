@@ -0,0 +1,339 @@
+// Package media uploads local files referenced by notes to the Anki media folder.
+package media
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+
+	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/logging"
+)
+
+var (
+	// srcAttr matches the src attribute of img, audio, video and source tags.
+	srcAttr = regexp.MustCompile(`(?i)(<(?:img|audio|video|source)\b[^>]*?\bsrc\s*=\s*)(["'])([^"']+)(["'])`)
+	// soundTag matches Anki sound references.
+	soundTag = regexp.MustCompile(`\[sound:([^\]]+)\]`)
+	// remoteRef matches references that are not local paths.
+	remoteRef = regexp.MustCompile(`^(?i:[a-z][a-z0-9+.-]*:)`)
+)
+
+// hashLen is the number of hex digits of the content hash kept in stored names.
+const hashLen = 16
+
+// Uploader stores local files in Anki under content-hashed names, so that
+// different files never clash and unchanged files are never sent twice.
+type Uploader struct {
+	client anki.Connector
+	dryRun bool
+	logger *logging.Logger
+
+	// mu guards uploads only; the requests of different files run
+	// concurrently while a file is stored at most once.
+	mu      sync.Mutex
+	uploads map[string]*upload
+}
+
+// upload is the storing of a single file, shared by every note using it.
+type upload struct {
+	done chan struct{}
+	err  error
+}
+
+func NewUploader(client anki.Connector, dryRun bool, logger *logging.Logger) *Uploader {
+	return &Uploader{
+		client:  client,
+		dryRun:  dryRun,
+		logger:  logger,
+		uploads: make(map[string]*upload),
+	}
+}
+
+// File is a local file used by a note.
+type File struct {
+	// Ref is the reference as written in the note.
+	Ref string
+	// Path is the local path of the file.
+	Path string
+	// Name is the name the file is stored under in Anki.
+	Name string
+}
+
+// localFile is a File with the content it was named after, so that the
+// upload sends exactly what was hashed.
+type localFile struct {
+	File
+	data []byte
+}
+
+// Resolve finds the local files used by the note and returns a copy of the
+// note whose fields reference their stored names. It doesn't talk to Anki.
+// Local paths are resolved relative to baseDir. References to files that do
+// not exist locally are assumed to be in the Anki media folder already and
+// are left untouched, unless they are explicitly relative (./ or ../).
+func Resolve(baseDir string, note anki.Note) (anki.Note, []File, error) {
+	note, local, err := resolve(baseDir, note)
+	files := make([]File, len(local))
+	for i, f := range local {
+		files[i] = f.File
+	}
+	return note, files, err
+}
+
+func resolve(baseDir string, note anki.Note) (anki.Note, []localFile, error) {
+	refs := make(map[string]bool)
+	for _, value := range note.Fields {
+		for _, ref := range References(value) {
+			refs[ref] = true
+		}
+	}
+	for _, ref := range note.Media {
+		refs[ref] = true
+	}
+	if len(refs) == 0 {
+		return note, nil, nil
+	}
+
+	var files []localFile
+	names := make(map[string]string, len(refs))
+	for ref := range refs {
+		local, ok, err := localPath(baseDir, ref)
+		if err != nil {
+			return note, nil, err
+		}
+		if !ok {
+			continue
+		}
+		data, err := os.ReadFile(local)
+		if err != nil {
+			return note, nil, fmt.Errorf("media %s: %w", ref, err)
+		}
+		names[ref] = StoredName(local, data)
+		files = append(files, localFile{File: File{Ref: ref, Path: local, Name: names[ref]}, data: data})
+	}
+	if len(files) == 0 {
+		return note, nil, nil
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Ref < files[j].Ref })
+
+	fields := make(map[string]string, len(note.Fields))
+	for field, value := range note.Fields {
+		fields[field] = replace(value, names, note.Media)
+	}
+	note.Fields = fields
+	return note, files, nil
+}
+
+// Unresolve turns stored names in a value from Anki back into the references
+// used in the source.
+func Unresolve(value string, files []File) string {
+	for _, f := range files {
+		value = strings.ReplaceAll(value, f.Name, f.Ref)
+	}
+	return value
+}
+
+// Rewrite uploads the local files used by the note and returns a copy of the
+// note whose fields reference the stored names, see Resolve.
+func (u *Uploader) Rewrite(ctx context.Context, baseDir string, note anki.Note) (anki.Note, error) {
+	note, files, err := resolve(baseDir, note)
+	if err != nil {
+		return note, err
+	}
+	for _, f := range files {
+		if err := u.store(ctx, f); err != nil {
+			return note, fmt.Errorf("media %s: %w", f.Ref, err)
+		}
+	}
+	return note, nil
+}
+
+// References returns the media paths referenced from a field value.
+func References(value string) []string {
+	var refs []string
+	for _, m := range srcAttr.FindAllStringSubmatch(value, -1) {
+		refs = append(refs, m[3])
+	}
+	for _, m := range soundTag.FindAllStringSubmatch(value, -1) {
+		refs = append(refs, m[1])
+	}
+	return refs
+}
+
+// StoredName is the name a file with the given content is stored under:
+// the original base name with a content hash appended.
+func StoredName(path string, data []byte) string {
+	sum := sha256.Sum256(data)
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(filepath.Base(path), ext)
+	return fmt.Sprintf("%s-%s%s", stem, hex.EncodeToString(sum[:])[:hashLen], ext)
+}
+
+// store stores f in Anki unless it was stored by this uploader already.
+// Concurrent calls for the same name wait for the first one.
+func (u *Uploader) store(ctx context.Context, f localFile) error {
+	u.mu.Lock()
+	if up, ok := u.uploads[f.Name]; ok {
+		u.mu.Unlock()
+		select {
+		case <-up.done:
+			return up.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	up := &upload{done: make(chan struct{})}
+	u.uploads[f.Name] = up
+	u.mu.Unlock()
+
+	up.err = u.upload(ctx, f)
+	if up.err != nil {
+		// A later note retries the file.
+		u.mu.Lock()
+		delete(u.uploads, f.Name)
+		u.mu.Unlock()
+	}
+	close(up.done)
+	return up.err
+}
+
+func (u *Uploader) upload(ctx context.Context, f localFile) error {
+	l := u.logger.CloneWith(zap.String("file", f.Path), zap.String("media", f.Name))
+
+	present, err := u.present(ctx, f.Name)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case present:
+		l.Debug("media file is already in Anki")
+	case u.dryRun:
+		l.DryRunLogger().Info("would upload media file")
+	default:
+		if _, err := u.client.StoreMediaFile(ctx, f.Name, f.data); err != nil {
+			return err
+		}
+		l.Info("media file uploaded")
+	}
+	return nil
+}
+
+// present reports whether Anki already has a file under name. Names carry
+// the hash of the content, so a file with the name has the same content.
+func (u *Uploader) present(ctx context.Context, name string) (bool, error) {
+	names, err := u.client.GetMediaFilesNames(ctx, globEscape(name))
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(names, name), nil
+}
+
+// localPath resolves a reference against baseDir. The boolean is false for
+// remote references and for files that are only expected in the media folder.
+func localPath(baseDir, ref string) (string, bool, error) {
+	if remoteRef.MatchString(ref) {
+		return "", false, nil
+	}
+
+	path := ref
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, ref)
+	}
+
+	info, err := os.Stat(path)
+	explicit := strings.HasPrefix(ref, "./") || strings.HasPrefix(ref, "../") || filepath.IsAbs(ref)
+	switch {
+	case errors.Is(err, os.ErrNotExist) && !explicit:
+		return "", false, nil
+	case err != nil:
+		return "", false, fmt.Errorf("media %s: %w", ref, err)
+	case info.IsDir():
+		return "", false, fmt.Errorf("media %s is a directory", ref)
+	}
+	return path, true, nil
+}
+
+// replace swaps references in a field value for the stored names.
+// Files listed explicitly may be referenced in any other way, so their paths
+// are replaced wherever they occur as a whole reference: "cat.png" is
+// replaced in "see cat.png" but neither in "img/cat.png" nor in "bobcat.png".
+func replace(value string, names map[string]string, listed []string) string {
+	value = srcAttr.ReplaceAllStringFunc(value, func(tag string) string {
+		m := srcAttr.FindStringSubmatch(tag)
+		if name, ok := names[m[3]]; ok {
+			return m[1] + m[2] + name + m[4]
+		}
+		return tag
+	})
+	value = soundTag.ReplaceAllStringFunc(value, func(tag string) string {
+		m := soundTag.FindStringSubmatch(tag)
+		if name, ok := names[m[1]]; ok {
+			return "[sound:" + name + "]"
+		}
+		return tag
+	})
+
+	for _, ref := range listed {
+		if name, ok := names[ref]; ok {
+			value = replaceWhole(value, ref, name)
+		}
+	}
+	return value
+}
+
+// replaceWhole replaces the occurrences of ref that are not part of a longer
+// path or name.
+func replaceWhole(value, ref, name string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(value, ref)
+		if i < 0 {
+			break
+		}
+		end := i + len(ref)
+		before, _ := utf8.DecodeLastRuneInString(value[:i])
+		after, _ := utf8.DecodeRuneInString(value[end:])
+		b.WriteString(value[:i])
+		if i > 0 && isPathRune(before) || end < len(value) && isPathRune(after) {
+			b.WriteString(ref)
+		} else {
+			b.WriteString(name)
+		}
+		value = value[end:]
+	}
+	b.WriteString(value)
+	return b.String()
+}
+
+// isPathRune reports whether r may continue a file path or name.
+func isPathRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("._-~/\\%+", r)
+}
+
+// globEscape quotes the characters that are special in media name patterns.
+func globEscape(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if strings.ContainsRune("*?[", r) {
+			b.WriteString("[" + string(r) + "]")
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,115 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/anki/ankitest"
+	"github.com/spigell/anki-sync/internal/logging"
+)
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{"cat.png": "cat", "img/cat.png": "img cat", "bobcat.png": "bobcat"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cat := StoredName("cat.png", []byte("cat"))
+	imgCat := StoredName("cat.png", []byte("img cat"))
+
+	tests := []struct {
+		name  string
+		value string
+		media []string
+		want  string
+	}{
+		{
+			name:  "src attribute",
+			value: `<img src="cat.png"> <img src='img/cat.png'>`,
+			want:  `<img src="` + cat + `"> <img src='` + imgCat + `'>`,
+		},
+		{
+			name:  "sound",
+			value: `[sound:cat.png]`,
+			want:  `[sound:` + cat + `]`,
+		},
+		{
+			name:  "listed file",
+			value: `see cat.png, "cat.png" or (cat.png)`,
+			media: []string{"cat.png"},
+			want:  `see ` + cat + `, "` + cat + `" or (` + cat + `)`,
+		},
+		{
+			name:  "listed file in longer paths",
+			value: `img/cat.png, bobcat.png, cat.png.bak, cat.pngx`,
+			media: []string{"cat.png"},
+			want:  `img/cat.png, bobcat.png, cat.png.bak, cat.pngx`,
+		},
+		{
+			name:  "listed files sharing a suffix",
+			value: `img/cat.png cat.png`,
+			media: []string{"cat.png", "img/cat.png"},
+			want:  imgCat + ` ` + cat,
+		},
+		{
+			name:  "missing file",
+			value: `<img src="dog.png">`,
+			want:  `<img src="dog.png">`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			note := anki.Note{Fields: map[string]string{"Front": tt.value}, Media: tt.media}
+			got, _, err := Resolve(dir, note)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if got.Fields["Front"] != tt.want {
+				t.Errorf("Resolve() = %q, want %q", got.Fields["Front"], tt.want)
+			}
+		})
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	data := []byte("meow")
+	if err := os.WriteFile(filepath.Join(dir, "cat.mp3"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	name := StoredName("cat.mp3", data)
+
+	fake := ankitest.NewFake()
+	u := NewUploader(fake, false, &logging.Logger{Logger: zap.NewNop()})
+	note := anki.Note{Fields: map[string]string{"Front": "[sound:cat.mp3]", "Back": "[sound:cat.mp3]"}}
+	got, err := u.Rewrite(ctx, dir, note)
+	if err != nil {
+		t.Fatalf("Rewrite() error = %v", err)
+	}
+	if want := "[sound:" + name + "]"; got.Fields["Front"] != want {
+		t.Errorf("Rewrite() Front = %q, want %q", got.Fields["Front"], want)
+	}
+
+	stored, ok, err := fake.RetrieveMediaFile(ctx, name)
+	if err != nil || !ok || !bytes.Equal(stored, data) {
+		t.Errorf("RetrieveMediaFile(%q) = %q, %v, %v, want %q", name, stored, ok, err, data)
+	}
+
+	// The file is stored once, a second rewrite finds it in the uploader.
+	fake.FailOn("storeMediaFile", os.ErrPermission)
+	if _, err := u.Rewrite(ctx, dir, note); err != nil {
+		t.Errorf("second Rewrite() error = %v", err)
+	}
+}
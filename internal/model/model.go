@@ -3,23 +3,29 @@ package model
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/spigell/anki-sync/internal/anki"
 	"github.com/spigell/anki-sync/internal/logging"
+	"github.com/spigell/anki-sync/internal/plan"
 	"go.uber.org/zap"
 )
 
 type Manager struct {
 	ctx    context.Context
-	client *anki.Client
+	client anki.Connector
 	dryRun bool
 	logger *logging.Logger
 	data   *anki.Data
+
+	removeFields    bool
+	removeTemplates bool
 }
 
 type ManagerOption func(*Manager)
 
-func NewModelManager(ctx context.Context, client *anki.Client, dryRun bool, logger *logging.Logger, data *anki.Data, opts ...ManagerOption) *Manager {
+func NewModelManager(ctx context.Context, client anki.Connector, dryRun bool, logger *logging.Logger, data *anki.Data, opts ...ManagerOption) *Manager {
 	m := &Manager{
 		ctx:    ctx,
 		client: client,
@@ -35,6 +41,23 @@ func NewModelManager(ctx context.Context, client *anki.Client, dryRun bool, logg
 	return m
 }
 
+// WithFieldRemoval removes fields missing from the sources from the models in
+// Anki, which deletes their contents in every note. Without it such fields are
+// kept after the fields of the sources.
+func WithFieldRemoval(remove bool) ManagerOption {
+	return func(m *Manager) {
+		m.removeFields = remove
+	}
+}
+
+// WithTemplateRemoval removes card templates missing from the sources from
+// the models in Anki, which deletes their cards and review history.
+func WithTemplateRemoval(remove bool) ManagerOption {
+	return func(m *Manager) {
+		m.removeTemplates = remove
+	}
+}
+
 func (m *Manager) Sync() error {
 	for _, model := range m.data.Models {
 		modelLogger := m.logger.CloneWith(zap.String("name", model.Name))
@@ -44,44 +67,382 @@ func (m *Manager) Sync() error {
 		default:
 		}
 
-		exists, err := m.client.ModelExists(m.ctx, model.Name)
-		if err != nil {
-			return fmt.Errorf("getting status model %s: %w", model.Name, err)
-		}
-
 		if m.dryRun {
-			if !exists {
-				modelLogger.DryRunLogger().Info("would create model")
-			}
-			for _, t := range model.CardTemplates {
-				modelLogger.DryRunLogger().Info("would update template", zap.String("name", t.Name), zap.String("front", t.Front), zap.String("back", t.Back))
-			}
-			if model.CSS != "" {
-				modelLogger.DryRunLogger().Info("would update css", zap.String("css", model.CSS))
+			change, err := m.diff(model)
+			if err != nil {
+				return err
 			}
+			logChange(modelLogger, change)
 			continue
 		}
 
+		exists, err := m.client.ModelExists(m.ctx, model.Name)
+		if err != nil {
+			return fmt.Errorf("getting status model %s: %w", model.Name, err)
+		}
+
 		if !exists {
 			modelLogger.Info("creating model")
 
 			if err := m.client.CreateModel(m.ctx, model); err != nil {
 				return fmt.Errorf("create model %s: %w", model.Name, err)
 			}
+			continue
+		}
+
+		// Every update of a model makes the next sync with AnkiWeb a full one,
+		// so only what differs is pushed.
+		if err := m.syncFields(model, modelLogger); err != nil {
+			return err
+		}
+		if err := m.syncTemplates(model, modelLogger); err != nil {
+			return err
+		}
+		if err := m.syncStyling(model, modelLogger); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Plan adds the changes Sync would make to the models to p without applying them.
+func (m *Manager) Plan(p *plan.Plan) error {
+	for _, model := range m.data.Models {
+		change, err := m.diff(model)
+		if err != nil {
+			return err
+		}
+		if change != nil {
+			p.Models = append(p.Models, *change)
+		}
+	}
+	return nil
+}
+
+// diff compares a model with its current state in Anki.
+// It returns nil when the model is up-to-date.
+func (m *Manager) diff(model anki.Model) (*plan.ModelChange, error) {
+	exists, err := m.client.ModelExists(m.ctx, model.Name)
+	if err != nil {
+		return nil, fmt.Errorf("getting status model %s: %w", model.Name, err)
+	}
+	if !exists {
+		return &plan.ModelChange{Name: model.Name, Action: plan.Create}, nil
+	}
+
+	templates, err := m.client.GetModelTemplates(m.ctx, model.Name)
+	if err != nil {
+		return nil, fmt.Errorf("get model templates %s: %w", model.Name, err)
+	}
+	css, err := m.client.GetModelStyling(m.ctx, model.Name)
+	if err != nil {
+		return nil, fmt.Errorf("get model css %s: %w", model.Name, err)
+	}
+	fields, err := m.client.GetModelFieldNames(m.ctx, model.Name)
+	if err != nil {
+		return nil, fmt.Errorf("get model fields %s: %w", model.Name, err)
+	}
+
+	change := plan.ModelChange{Name: model.Name, Action: plan.Update}
+
+	change.Templates, _ = templateChanges(model, templates, m.removeTemplates)
+
+	if model.CSS != "" && !same(model.CSS, css) {
+		change.CSS = &plan.TextChange{Before: css, After: model.CSS}
+	}
+
+	change.Fields, _ = fieldChanges(model, fields, m.removeFields)
+
+	if len(change.Templates) == 0 && change.CSS == nil && len(change.Fields) == 0 {
+		return nil, nil
+	}
+	return &change, nil
+}
+
+func logChange(logger *logging.Logger, change *plan.ModelChange) {
+	l := logger.DryRunLogger()
+	if change == nil {
+		l.Info("model is up-to-date")
+		return
+	}
+
+	if change.Action == plan.Create {
+		l.Info("would create model")
+		return
+	}
+	for _, t := range change.Templates {
+		logTemplate(l, t, "would ")
+	}
+	if change.CSS != nil {
+		l.Info("would update css", zap.Strings("diff", plan.UnifiedDiff(change.CSS.Before, change.CSS.After)))
+	}
+	for _, f := range change.Fields {
+		logField(l, f, "would ")
+	}
+}
+
+func logField(l *zap.Logger, f plan.FieldChange, prefix string) {
+	switch f.Action {
+	case plan.Create:
+		l.Info(prefix+"add field", zap.String("field", f.Name), zap.Int("position", f.Position))
+	case plan.Rename:
+		l.Info(prefix+"rename field", zap.String("field", f.Name), zap.String("from", f.From))
+	case plan.Delete:
+		l.Warn(prefix+"remove field and its contents in every note", zap.String("field", f.Name))
+	case plan.Move:
+		l.Info(prefix+"move field", zap.String("field", f.Name), zap.Int("position", f.Position))
+	}
+}
+
+// syncFields brings the fields of an existing model in line with the sources.
+func (m *Manager) syncFields(model anki.Model, logger *logging.Logger) error {
+	fields, err := m.client.GetModelFieldNames(m.ctx, model.Name)
+	if err != nil {
+		return fmt.Errorf("get model fields %s: %w", model.Name, err)
+	}
+
+	changes, kept := fieldChanges(model, fields, m.removeFields)
+	if len(kept) > 0 {
+		logger.Warn("fields exist only in Anki and are kept, enable field removal to delete them", zap.Strings("fields", kept))
+	}
+
+	for _, c := range changes {
+		switch c.Action {
+		case plan.Create:
+			err = m.client.ModelFieldAdd(m.ctx, model.Name, c.Name, c.Position)
+		case plan.Rename:
+			err = m.client.ModelFieldRename(m.ctx, model.Name, c.From, c.Name)
+		case plan.Delete:
+			err = m.client.ModelFieldRemove(m.ctx, model.Name, c.Name)
+		case plan.Move:
+			err = m.client.ModelFieldReposition(m.ctx, model.Name, c.Name, c.Position)
+		}
+		if err != nil {
+			return fmt.Errorf("%s field %s of model %s: %w", c.Action, c.Name, model.Name, err)
+		}
+		logField(logger.Logger, c, "")
+	}
+	return nil
+}
+
+// fieldChanges lists the changes turning the fields of a model in Anki into
+// the fields of the sources: renames first, so that note contents are kept,
+// then additions, removals and finally moves. Fields only in Anki are
+// removed if remove is set, and returned and placed last otherwise.
+func fieldChanges(model anki.Model, have []string, remove bool) ([]plan.FieldChange, []string) {
+	var changes []plan.FieldChange
+	current := slices.Clone(have)
+
+	for _, f := range model.InOrderFields {
+		from, ok := model.RenamedFrom[f]
+		if !ok || slices.Contains(current, f) {
+			continue
+		}
+		if i := slices.Index(current, from); i >= 0 {
+			current[i] = f
+			changes = append(changes, plan.FieldChange{Action: plan.Rename, Name: f, From: from, Position: i})
 		}
+	}
 
-		modelLogger.Info("updating model")
+	for i, f := range model.InOrderFields {
+		if slices.Contains(current, f) {
+			continue
+		}
+		i = min(i, len(current))
+		current = slices.Insert(current, i, f)
+		changes = append(changes, plan.FieldChange{Action: plan.Create, Name: f, Position: i})
+	}
 
-		if err := m.client.UpdateModelTemplates(m.ctx, model.Name, model.CardTemplates); err != nil {
-			return fmt.Errorf("update model templates `%s`: %w", model.Name, err)
+	var extra []string
+	for _, f := range current {
+		if !slices.Contains(model.InOrderFields, f) {
+			extra = append(extra, f)
 		}
+	}
+	if remove {
+		for _, f := range extra {
+			i := slices.Index(current, f)
+			current = slices.Delete(current, i, i+1)
+			changes = append(changes, plan.FieldChange{Action: plan.Delete, Name: f, Position: i})
+		}
+		extra = nil
+	}
 
-		if model.CSS != "" {
-			if err := m.client.UpdateModelStyling(m.ctx, model.Name, model.CSS); err != nil {
-				return fmt.Errorf("update model css %s: %w", model.Name, err)
+	for i, f := range append(slices.Clone(model.InOrderFields), extra...) {
+		if current[i] == f {
+			continue
+		}
+		j := slices.Index(current, f)
+		current = slices.Insert(slices.Delete(current, j, j+1), i, f)
+		changes = append(changes, plan.FieldChange{Action: plan.Move, Name: f, Position: i})
+	}
+
+	return changes, extra
+}
+
+func logTemplate(l *zap.Logger, t plan.TemplateChange, prefix string) {
+	switch t.Action {
+	case plan.Create:
+		l.Info(prefix+"add template", zap.String("template", t.Name))
+	case plan.Rename:
+		l.Info(prefix+"rename template", zap.String("template", t.Name), zap.String("from", t.From))
+	case plan.Delete:
+		l.Warn(prefix+"remove template with its cards and their review history", zap.String("template", t.Name))
+	default:
+		l.Info(prefix+"update template", zap.String("template", t.Name), zap.String("side", t.Side),
+			zap.Strings("diff", plan.UnifiedDiff(t.Diff.Before, t.Diff.After)))
+	}
+}
+
+// syncTemplates adds, renames and removes the card templates of an existing
+// model and updates the templates whose contents differ.
+func (m *Manager) syncTemplates(model anki.Model, logger *logging.Logger) error {
+	templates, err := m.client.GetModelTemplates(m.ctx, model.Name)
+	if err != nil {
+		return fmt.Errorf("get model templates %s: %w", model.Name, err)
+	}
+
+	changes, kept := templateChanges(model, templates, m.removeTemplates)
+	if len(kept) > 0 {
+		logger.Warn("templates exist only in Anki and are kept, enable template removal to delete them", zap.Strings("templates", kept))
+	}
+
+	var updated []anki.CardTemplate
+	for _, c := range changes {
+		i := slices.IndexFunc(model.CardTemplates, func(t anki.CardTemplate) bool { return t.Name == c.Name })
+		switch c.Action {
+		case plan.Create:
+			err = m.client.ModelTemplateAdd(m.ctx, model.Name, model.CardTemplates[i])
+		case plan.Rename:
+			err = m.client.ModelTemplateRename(m.ctx, model.Name, c.From, c.Name)
+		case plan.Delete:
+			err = m.client.ModelTemplateRemove(m.ctx, model.Name, c.Name)
+		default:
+			if !slices.ContainsFunc(updated, func(t anki.CardTemplate) bool { return t.Name == c.Name }) {
+				updated = append(updated, model.CardTemplates[i])
 			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s template %s of model %s: %w", c.Action, c.Name, model.Name, err)
 		}
+		logTemplate(logger.Logger, c, "")
 	}
 
+	if len(updated) == 0 {
+		return nil
+	}
+	if err := m.client.UpdateModelTemplates(m.ctx, model.Name, updated); err != nil {
+		return fmt.Errorf("update model templates `%s`: %w", model.Name, err)
+	}
+	for _, c := range changes {
+		if c.Action == plan.Update {
+			logTemplate(logger.Logger, c, "")
+		}
+	}
 	return nil
 }
+
+// syncStyling updates the CSS of an existing model if it differs.
+func (m *Manager) syncStyling(model anki.Model, logger *logging.Logger) error {
+	if model.CSS == "" {
+		return nil
+	}
+
+	css, err := m.client.GetModelStyling(m.ctx, model.Name)
+	if err != nil {
+		return fmt.Errorf("get model css %s: %w", model.Name, err)
+	}
+	if same(model.CSS, css) {
+		return nil
+	}
+
+	if err := m.client.UpdateModelStyling(m.ctx, model.Name, model.CSS); err != nil {
+		return fmt.Errorf("update model css %s: %w", model.Name, err)
+	}
+	logger.Info("update css", zap.Strings("diff", plan.UnifiedDiff(css, model.CSS)))
+	return nil
+}
+
+// same reports whether two templates or style sheets differ only in line
+// endings, trailing whitespace of lines and surrounding blank lines.
+func same(a, b string) bool {
+	return normalize(a) == normalize(b)
+}
+
+func normalize(s string) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " \t")
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// templateChanges compares the card templates of a model with the ones in
+// Anki. Renames come first, then additions, removals and updates of the
+// template sides. Templates only in Anki are removed if remove is set, and
+// returned otherwise.
+func templateChanges(model anki.Model, have []anki.CardTemplate, remove bool) ([]plan.TemplateChange, []string) {
+	var changes []plan.TemplateChange
+
+	current := make(map[string]anki.CardTemplate, len(have))
+	for _, t := range have {
+		current[t.Name] = t
+	}
+
+	for _, t := range model.CardTemplates {
+		if _, ok := current[t.Name]; ok || t.RenamedFrom == "" {
+			continue
+		}
+		if old, ok := current[t.RenamedFrom]; ok {
+			delete(current, t.RenamedFrom)
+			current[t.Name] = old
+			changes = append(changes, plan.TemplateChange{Action: plan.Rename, Name: t.Name, From: t.RenamedFrom})
+		}
+	}
+
+	added := make(map[string]bool)
+	for _, t := range model.CardTemplates {
+		if _, ok := current[t.Name]; !ok {
+			added[t.Name] = true
+			changes = append(changes, plan.TemplateChange{Action: plan.Create, Name: t.Name})
+		}
+	}
+
+	var extra []string
+	for _, t := range have {
+		if _, ok := current[t.Name]; !ok {
+			// Renamed.
+			continue
+		}
+		if !slices.ContainsFunc(model.CardTemplates, func(c anki.CardTemplate) bool { return c.Name == t.Name }) {
+			extra = append(extra, t.Name)
+		}
+	}
+	if remove {
+		for _, name := range extra {
+			changes = append(changes, plan.TemplateChange{Action: plan.Delete, Name: name})
+		}
+		extra = nil
+	}
+
+	for _, t := range model.CardTemplates {
+		if added[t.Name] {
+			continue
+		}
+		c := current[t.Name]
+		if !same(c.Front, t.Front) {
+			changes = append(changes, plan.TemplateChange{
+				Action: plan.Update, Name: t.Name, Side: "front", Diff: &plan.TextChange{Before: c.Front, After: t.Front},
+			})
+		}
+		if !same(c.Back, t.Back) {
+			changes = append(changes, plan.TemplateChange{
+				Action: plan.Update, Name: t.Name, Side: "back", Diff: &plan.TextChange{Before: c.Back, After: t.Back},
+			})
+		}
+	}
+
+	return changes, extra
+}
@@ -0,0 +1,244 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/anki/ankitest"
+	"github.com/spigell/anki-sync/internal/logging"
+	"github.com/spigell/anki-sync/internal/plan"
+	"go.uber.org/zap"
+)
+
+func testLogger() *logging.Logger {
+	return &logging.Logger{Logger: zap.NewNop()}
+}
+
+func TestFieldChanges(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     anki.Model
+		have      []string
+		remove    bool
+		want      []plan.FieldChange
+		wantExtra []string
+	}{
+		{
+			name:  "unchanged",
+			model: anki.Model{InOrderFields: []string{"Front", "Back"}},
+			have:  []string{"Front", "Back"},
+		},
+		{
+			name:  "added",
+			model: anki.Model{InOrderFields: []string{"Front", "Extra", "Back"}},
+			have:  []string{"Front", "Back"},
+			want:  []plan.FieldChange{{Action: plan.Create, Name: "Extra", Position: 1}},
+		},
+		{
+			name:  "renamed",
+			model: anki.Model{InOrderFields: []string{"Word", "Back"}, RenamedFrom: map[string]string{"Word": "Front"}},
+			have:  []string{"Front", "Back"},
+			want:  []plan.FieldChange{{Action: plan.Rename, Name: "Word", From: "Front", Position: 0}},
+		},
+		{
+			name:  "rename already applied",
+			model: anki.Model{InOrderFields: []string{"Word", "Back"}, RenamedFrom: map[string]string{"Word": "Front"}},
+			have:  []string{"Word", "Back"},
+		},
+		{
+			name:  "moved",
+			model: anki.Model{InOrderFields: []string{"Back", "Front"}},
+			have:  []string{"Front", "Back"},
+			want:  []plan.FieldChange{{Action: plan.Move, Name: "Back", Position: 0}},
+		},
+		{
+			name:      "extra kept last",
+			model:     anki.Model{InOrderFields: []string{"Back"}},
+			have:      []string{"Extra", "Back"},
+			want:      []plan.FieldChange{{Action: plan.Move, Name: "Back", Position: 0}},
+			wantExtra: []string{"Extra"},
+		},
+		{
+			name:   "extra removed",
+			model:  anki.Model{InOrderFields: []string{"Front"}},
+			have:   []string{"Front", "Back"},
+			remove: true,
+			want:   []plan.FieldChange{{Action: plan.Delete, Name: "Back", Position: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, extra := fieldChanges(tt.model, tt.have, tt.remove)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fieldChanges() = %+v, want %+v", got, tt.want)
+			}
+			if !slices.Equal(extra, tt.wantExtra) {
+				t.Errorf("fieldChanges() extra = %v, want %v", extra, tt.wantExtra)
+			}
+		})
+	}
+}
+
+func TestTemplateChanges(t *testing.T) {
+	card1 := anki.CardTemplate{Name: "Card 1", Front: "{{Front}}", Back: "{{Back}}"}
+	card2 := anki.CardTemplate{Name: "Card 2", Front: "{{Back}}", Back: "{{Front}}"}
+	have := []anki.CardTemplate{card1}
+
+	tests := []struct {
+		name      string
+		templates []anki.CardTemplate
+		remove    bool
+		want      []plan.TemplateChange
+		wantExtra []string
+	}{
+		{
+			name:      "unchanged",
+			templates: []anki.CardTemplate{card1},
+		},
+		{
+			name:      "whitespace only",
+			templates: []anki.CardTemplate{{Name: "Card 1", Front: "{{Front}}  \r\n", Back: "\n{{Back}}"}},
+		},
+		{
+			name:      "side updated",
+			templates: []anki.CardTemplate{{Name: "Card 1", Front: "{{Front}}<br>", Back: "{{Back}}"}},
+			want: []plan.TemplateChange{{
+				Action: plan.Update, Name: "Card 1", Side: "front",
+				Diff: &plan.TextChange{Before: "{{Front}}", After: "{{Front}}<br>"},
+			}},
+		},
+		{
+			name:      "added",
+			templates: []anki.CardTemplate{card1, card2},
+			want:      []plan.TemplateChange{{Action: plan.Create, Name: "Card 2"}},
+		},
+		{
+			name:      "renamed",
+			templates: []anki.CardTemplate{{Name: "Forward", RenamedFrom: "Card 1", Front: "{{Front}}", Back: "{{Back}}"}},
+			want:      []plan.TemplateChange{{Action: plan.Rename, Name: "Forward", From: "Card 1"}},
+		},
+		{
+			name:      "extra kept",
+			templates: []anki.CardTemplate{card2},
+			want:      []plan.TemplateChange{{Action: plan.Create, Name: "Card 2"}},
+			wantExtra: []string{"Card 1"},
+		},
+		{
+			name:      "extra removed",
+			templates: []anki.CardTemplate{card2},
+			remove:    true,
+			want: []plan.TemplateChange{
+				{Action: plan.Create, Name: "Card 2"},
+				{Action: plan.Delete, Name: "Card 1"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, extra := templateChanges(anki.Model{Name: "Basic", CardTemplates: tt.templates}, have, tt.remove)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("templateChanges() = %+v, want %+v", got, tt.want)
+			}
+			if !slices.Equal(extra, tt.wantExtra) {
+				t.Errorf("templateChanges() extra = %v, want %v", extra, tt.wantExtra)
+			}
+		})
+	}
+}
+
+// vocabulary is the stock Basic model with a renamed field, an extra field,
+// a second card and its own styling.
+func vocabulary(name string) anki.Model {
+	return anki.Model{
+		Name:          name,
+		InOrderFields: []string{"Word", "Back", "Example"},
+		RenamedFrom:   map[string]string{"Word": "Front"},
+		CSS:           ".card { color: black; }",
+		CardTemplates: []anki.CardTemplate{
+			{Name: "Card 1", Front: "{{Word}}", Back: "{{Back}}<br>{{Example}}"},
+			{Name: "Card 2", Front: "{{Back}}", Back: "{{Word}}"},
+		},
+	}
+}
+
+func TestSync(t *testing.T) {
+	tests := []struct {
+		name  string
+		model anki.Model
+	}{
+		{name: "created", model: vocabulary("Vocabulary")},
+		{name: "updated", model: vocabulary("Basic")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := ankitest.NewFake()
+			data := &anki.Data{Models: []anki.Model{tt.model}}
+
+			p := &plan.Plan{}
+			if err := NewModelManager(context.Background(), fake, false, testLogger(), data).Plan(p); err != nil {
+				t.Fatalf("Plan() error = %v", err)
+			}
+			if len(p.Models) != 1 {
+				t.Fatalf("Plan() models = %+v, want one change", p.Models)
+			}
+
+			if err := NewModelManager(context.Background(), fake, false, testLogger(), data).Sync(); err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			got, ok := fake.Model(tt.model.Name)
+			if !ok {
+				t.Fatalf("model %s is missing", tt.model.Name)
+			}
+			if !slices.Equal(got.InOrderFields, tt.model.InOrderFields) {
+				t.Errorf("fields = %v, want %v", got.InOrderFields, tt.model.InOrderFields)
+			}
+			if got.CSS != tt.model.CSS {
+				t.Errorf("css = %q, want %q", got.CSS, tt.model.CSS)
+			}
+			if len(got.CardTemplates) != 2 || got.CardTemplates[1].Front != "{{Back}}" {
+				t.Errorf("templates = %+v, want %+v", got.CardTemplates, tt.model.CardTemplates)
+			}
+
+			p = &plan.Plan{}
+			if err := NewModelManager(context.Background(), fake, false, testLogger(), data).Plan(p); err != nil {
+				t.Fatalf("Plan() error = %v", err)
+			}
+			if len(p.Models) != 0 {
+				t.Errorf("Plan() after Sync() = %+v, want no changes", p.Models)
+			}
+		})
+	}
+}
+
+func TestSyncFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		model  anki.Model
+		action string
+	}{
+		{name: "status", model: vocabulary("Basic"), action: "modelNames"},
+		{name: "creation", model: vocabulary("Vocabulary"), action: "createModel"},
+		{name: "field rename", model: vocabulary("Basic"), action: "modelFieldRename"},
+		{name: "field addition", model: vocabulary("Basic"), action: "modelFieldAdd"},
+		{name: "template addition", model: vocabulary("Basic"), action: "modelTemplateAdd"},
+		{name: "template update", model: vocabulary("Basic"), action: "updateModelTemplates"},
+		{name: "styling", model: vocabulary("Basic"), action: "updateModelStyling"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := ankitest.NewFake()
+			fake.FailOn(tt.action, errors.New("collection is not available"))
+
+			data := &anki.Data{Models: []anki.Model{tt.model}}
+			err := NewModelManager(context.Background(), fake, false, testLogger(), data).Sync()
+			if err == nil || !strings.Contains(err.Error(), "collection is not available") {
+				t.Errorf("Sync() error = %v, want the AnkiConnect one", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/render"
+)
+
+// HighlightCode turns the code blocks in the note fields into highlighted
+// HTML, using the theme of the deck model. Like Markdown, this happens before
+// the notes are compared with Anki.
+// Fields written in Markdown are always highlighted. Other fields are left
+// as written unless the model sets a code theme, as HTML fields may hold
+// fences that are meant literally.
+func HighlightCode(decks []anki.Deck, models []anki.Model) error {
+	for d := range decks {
+		deck := &decks[d]
+		theme, html := render.DefaultTheme, false
+		if i := slices.IndexFunc(models, func(m anki.Model) bool { return m.Name == deck.Model }); i >= 0 && models[i].CodeTheme != "" {
+			theme, html = models[i].CodeTheme, true
+		}
+
+		for n := range deck.Notes {
+			note := &deck.Notes[n]
+			for field, value := range note.Fields {
+				if !html && deck.FieldFormat(field) != anki.FormatMarkdown {
+					continue
+				}
+				out, found, err := render.Code(value, theme)
+				if err != nil {
+					return fmt.Errorf("%s:%d: field %q: %w", deck.Source, note.Line, field, err)
+				}
+				if !found {
+					continue
+				}
+				if note.Rendered == nil {
+					note.Rendered = make(map[string]string)
+				}
+				if _, ok := note.Rendered[field]; !ok {
+					note.Rendered[field] = value
+				}
+				note.Fields[field] = out
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spigell/anki-sync/internal/anki"
+)
+
+func TestHighlightCode(t *testing.T) {
+	const fence = "```go\ndefer f.Close()\n```"
+
+	tests := []struct {
+		name   string
+		format string
+		theme  string
+		want   bool
+	}{
+		{name: "html field", format: anki.FormatHTML},
+		{name: "html field of a model with a theme", format: anki.FormatHTML, theme: "monokai", want: true},
+		{name: "markdown field", format: anki.FormatMarkdown, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decks := []anki.Deck{{
+				Deck:         "Go",
+				Model:        "Programming",
+				FieldFormats: map[string]string{"Back": tt.format},
+				Notes:        []anki.Note{{Fields: map[string]string{"Front": fence, "Back": fence}}},
+			}}
+			models := []anki.Model{{Name: "Programming", CodeTheme: tt.theme}}
+			if err := HighlightCode(decks, models); err != nil {
+				t.Fatalf("HighlightCode() error = %v", err)
+			}
+
+			note := decks[0].Notes[0]
+			if got := note.Fields["Back"] != fence; got != tt.want {
+				t.Errorf("Back highlighted = %v, want %v: %q", got, tt.want, note.Fields["Back"])
+			}
+			if tt.want && (!strings.Contains(note.Fields["Back"], "<pre") || note.Rendered["Back"] != fence) {
+				t.Errorf("Back = %q, rendered from %q, want highlighted HTML from the fence", note.Fields["Back"], note.Rendered["Back"])
+			}
+			// Front is an HTML field in every case.
+			if got := note.Fields["Front"] != fence; got != (tt.theme != "") {
+				t.Errorf("Front highlighted = %v, want %v", got, tt.theme != "")
+			}
+		})
+	}
+}
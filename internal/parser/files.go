@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spigell/anki-sync/internal/anki"
+)
+
+// resolveModelFiles reads the stylesheets and templates the models refer to.
+// Paths are relative to the directory of the models file.
+func resolveModelFiles(path string, models []anki.Model) []*ParseError {
+	dir := filepath.Dir(path)
+	var errs []*ParseError
+	fail := func(line int, format string, args ...any) {
+		errs = append(errs, &ParseError{Path: path, Line: line, Reason: fmt.Sprintf(format, args...)})
+	}
+	read := func(line int, key, file string) (string, bool) {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			errs = append(errs, &ParseError{Path: path, Line: line, Reason: fmt.Sprintf("%s: %v", key, err), Err: err})
+			return "", false
+		}
+		return string(data), true
+	}
+
+	for i := range models {
+		m := &models[i]
+
+		var css []string
+		for _, file := range m.IncludeCSS {
+			if text, ok := read(m.Line, "include_css", file); ok {
+				css = append(css, strings.TrimRight(text, "\n"))
+			}
+		}
+		switch {
+		case m.CSSFile != "" && m.CSS != "":
+			fail(m.Line, "model %q sets both css and css_file", m.Name)
+		case m.CSSFile != "":
+			if text, ok := read(m.Line, "css_file", m.CSSFile); ok {
+				css = append(css, strings.TrimRight(text, "\n"))
+			}
+		case m.CSS != "":
+			css = append(css, m.CSS)
+		}
+		if len(css) > 0 {
+			m.CSS = strings.Join(css, "\n\n")
+		}
+
+		for j := range m.CardTemplates {
+			t := &m.CardTemplates[j]
+			for _, side := range []struct {
+				name string
+				text *string
+				file string
+			}{{"front", &t.Front, t.FrontFile}, {"back", &t.Back, t.BackFile}} {
+				if side.file == "" {
+					continue
+				}
+				if *side.text != "" {
+					fail(t.Line, "template %q of model %q sets both %s and %s_file", t.Name, m.Name, side.name, side.name)
+					continue
+				}
+				if text, ok := read(t.Line, side.name+"_file", side.file); ok {
+					*side.text = text
+				}
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,261 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/spigell/anki-sync/internal/anki"
+)
+
+var (
+	// atxHeading matches a Markdown heading line: its level and text.
+	atxHeading = regexp.MustCompile(`^(#{1,6})[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$`)
+	// noteMeta matches the comments setting the tags and id of a note.
+	noteMeta = regexp.MustCompile(`^<!--\s*(tags|id):\s*(.*?)\s*-->$`)
+)
+
+// markdownHeader is the front matter of a Markdown deck: the deck settings
+// and the fields the `---` separated parts of a note go to.
+type markdownHeader struct {
+	anki.Deck `yaml:",inline"`
+	Fields    []string `yaml:"fields"`
+}
+
+// hasFrontMatter reports whether a Markdown file starts with front matter.
+func hasFrontMatter(data []byte) bool {
+	first, _, _ := bytes.Cut(data, []byte("\n"))
+	return string(bytes.TrimRight(first, " \t\r")) == "---"
+}
+
+func closesFrontMatter(line string) bool {
+	line = strings.TrimRight(line, " \t")
+	return line == "---" || line == "..."
+}
+
+// parseMarkdownDeck decodes a deck file in Markdown. The front matter holds
+// the deck settings, every top level heading starts a note and gives its
+// primary field, and the headings one level below name the other fields.
+// Without sub-headings, the note text is split on `---` lines into the
+// fields listed under `fields` in the front matter. Fields are Markdown
+// unless the deck says otherwise.
+//
+//	---
+//	deck_name: Go
+//	model_name: Basic
+//	primary_field: Front
+//	fields: [Back]
+//	---
+//
+//	# What does `defer` do?
+//	<!-- tags: keywords -->
+//	Runs a call when the surrounding function returns.
+func parseMarkdownDeck(path string, data []byte) (anki.Deck, []*ParseError) {
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	fail := func(line int, format string, args ...any) []*ParseError {
+		return []*ParseError{{Path: path, Line: line, Reason: fmt.Sprintf(format, args...)}}
+	}
+
+	end := slices.IndexFunc(lines[1:], closesFrontMatter)
+	if end < 0 {
+		return anki.Deck{}, fail(1, "front matter is not closed with ---")
+	}
+	end++
+	matter := []byte(strings.Join(lines[1:end], "\n"))
+	if len(bytes.TrimSpace(matter)) == 0 {
+		return anki.Deck{}, fail(1, "front matter is empty")
+	}
+
+	var header markdownHeader
+	if err := decodeStrict(matter, &header); err != nil {
+		errs := parseErrors(path, err)
+		for _, e := range errs {
+			if e.Line > 0 {
+				e.Line++
+			}
+		}
+		return anki.Deck{}, errs
+	}
+	deck := header.Deck
+	if len(deck.Notes) > 0 {
+		return deck, fail(1, "notes of a Markdown deck are its sections")
+	}
+	deck.Source = path
+	deck.ReadOnly = true
+	annotateDeck(document(matter), &deck)
+	for k := range deck.Lines {
+		deck.Lines[k]++
+	}
+	if deck.Format == "" {
+		deck.Format = anki.FormatMarkdown
+	}
+
+	body := scanMarkdown(lines[end+1:], end+2)
+	level := 0
+	for _, l := range body {
+		if l.heading > 0 && (level == 0 || l.heading < level) {
+			level = l.heading
+		}
+	}
+
+	var (
+		errs []*ParseError
+		note *anki.Note
+		text []markdownLine
+	)
+	flush := func() {
+		if note != nil {
+			errs = append(errs, noteFields(path, note, text, level, header.Fields)...)
+			deck.Notes = append(deck.Notes, *note)
+		}
+	}
+
+	for i := 0; i < len(body); i++ {
+		l := body[i]
+		if l.heading == 0 || l.heading != level {
+			if note == nil {
+				if strings.TrimSpace(l.text) != "" {
+					return deck, fail(l.number, "text before the first note heading")
+				}
+				continue
+			}
+			text = append(text, l)
+			continue
+		}
+
+		flush()
+		note = &anki.Note{Line: l.number, Fields: make(map[string]string), FieldLines: make(map[string]int)}
+		text = nil
+		if deck.PrimaryField != "" {
+			note.Fields[deck.PrimaryField] = l.title
+			note.FieldLines[deck.PrimaryField] = l.number
+		}
+		// Comments right below the heading set the tags and id.
+		for ; i+1 < len(body); i++ {
+			m := noteMeta.FindStringSubmatch(strings.TrimSpace(body[i+1].text))
+			if m == nil {
+				break
+			}
+			if m[1] == "tags" {
+				note.Tags = strings.Fields(m[2])
+			} else {
+				note.ID = m[2]
+			}
+		}
+	}
+	flush()
+	return deck, errs
+}
+
+// markdownLine is a line of a Markdown deck.
+type markdownLine struct {
+	number int
+	text   string
+	// heading is the level of a heading line, or 0, and title its text.
+	heading int
+	title   string
+	// code is set for the lines of fenced code blocks, which often start
+	// with # and are never headings or separators.
+	code bool
+}
+
+// scanMarkdown classifies the lines of a Markdown document. first is the line
+// number of the first line.
+func scanMarkdown(lines []string, first int) []markdownLine {
+	out := make([]markdownLine, len(lines))
+	fence := ""
+	for i, text := range lines {
+		out[i] = markdownLine{number: first + i, text: text}
+		trimmed := strings.TrimSpace(text)
+		switch {
+		case fence != "":
+			out[i].code = true
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			out[i].code = true
+			fence = trimmed[:3]
+		default:
+			if m := atxHeading.FindStringSubmatch(text); m != nil {
+				out[i].heading, out[i].title = len(m[1]), m[2]
+			}
+		}
+	}
+	return out
+}
+
+// noteFields fills the fields of a note from its body: the sections under
+// its sub-headings or, without them, the `---` separated parts.
+func noteFields(path string, note *anki.Note, body []markdownLine, level int, fields []string) []*ParseError {
+	fail := func(line int, format string, args ...any) []*ParseError {
+		return []*ParseError{{Path: path, Line: line, Reason: fmt.Sprintf(format, args...)}}
+	}
+	set := func(field string, line int, text []string) {
+		note.Fields[field] = strings.TrimSpace(strings.Join(text, "\n"))
+		note.FieldLines[field] = line
+	}
+
+	if slices.ContainsFunc(body, func(l markdownLine) bool { return l.heading == level+1 }) {
+		var (
+			field string
+			line  int
+			text  []string
+			seen  = make(map[string]bool)
+		)
+		for _, l := range body {
+			if l.heading == level+1 {
+				if field != "" {
+					set(field, line, text)
+				}
+				if seen[l.title] {
+					return fail(l.number, "field %q is set more than once", l.title)
+				}
+				seen[l.title] = true
+				field, line, text = l.title, l.number, nil
+				continue
+			}
+			if field == "" {
+				if strings.TrimSpace(l.text) != "" {
+					return fail(l.number, "text before the first field heading of the note")
+				}
+				continue
+			}
+			text = append(text, l.text)
+		}
+		set(field, line, text)
+		return nil
+	}
+
+	var (
+		parts [][]string
+		lines []int
+	)
+	for _, l := range body {
+		if !l.code && strings.TrimRight(l.text, " \t") == "---" {
+			parts = append(parts, nil)
+			lines = append(lines, l.number+1)
+			continue
+		}
+		if len(parts) == 0 {
+			parts = append(parts, nil)
+			lines = append(lines, l.number)
+		}
+		parts[len(parts)-1] = append(parts[len(parts)-1], l.text)
+	}
+	if len(parts) == 1 && strings.TrimSpace(strings.Join(parts[0], "")) == "" {
+		return nil
+	}
+	if len(fields) == 0 {
+		return fail(note.Line, "note text needs field sub-headings or `fields` in the front matter")
+	}
+	if len(parts) > len(fields) {
+		return fail(note.Line, "note has %d parts but the front matter lists %d fields", len(parts), len(fields))
+	}
+	for i, part := range parts {
+		set(fields[i], lines[i], part)
+	}
+	return nil
+}
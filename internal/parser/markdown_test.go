@@ -0,0 +1,162 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spigell/anki-sync/internal/anki"
+)
+
+func TestParseMarkdownDeck(t *testing.T) {
+	const matter = "---\ndeck_name: Go\nmodel_name: Basic\nprimary_field: Front\n"
+
+	tests := []struct {
+		name       string
+		data       string
+		wantFormat string
+		wantNotes  []anki.Note
+		wantErr    string
+		wantLine   int
+	}{
+		{
+			name: "field headings",
+			data: matter + "---\n\n" +
+				"# What does `defer` do?\n" +
+				"<!-- tags: keywords go -->\n" +
+				"<!-- id: d1 -->\n" +
+				"## Back\n" +
+				"Runs a call when the surrounding function returns.\n" +
+				"\n" +
+				"```go\n" +
+				"# not a heading\n" +
+				"```\n" +
+				"# Second\n" +
+				"## Back\n" +
+				"x\n",
+			wantFormat: anki.FormatMarkdown,
+			wantNotes: []anki.Note{
+				{
+					ID: "d1", Tags: []string{"keywords", "go"}, Line: 7,
+					Fields: map[string]string{
+						"Front": "What does `defer` do?",
+						"Back":  "Runs a call when the surrounding function returns.\n\n```go\n# not a heading\n```",
+					},
+					FieldLines: map[string]int{"Front": 7, "Back": 10},
+				},
+				{
+					Line:       16,
+					Fields:     map[string]string{"Front": "Second", "Back": "x"},
+					FieldLines: map[string]int{"Front": 16, "Back": 17},
+				},
+			},
+		},
+		{
+			name: "separated parts",
+			data: matter + "fields: [Back, Notes]\nformat: html\n---\n" +
+				"## Q1\n" +
+				"answer\n" +
+				"---\n" +
+				"note\n" +
+				"## Q2\n",
+			wantFormat: anki.FormatHTML,
+			wantNotes: []anki.Note{
+				{
+					Line:       8,
+					Fields:     map[string]string{"Front": "Q1", "Back": "answer", "Notes": "note"},
+					FieldLines: map[string]int{"Front": 8, "Back": 9, "Notes": 11},
+				},
+				{
+					Line:       12,
+					Fields:     map[string]string{"Front": "Q2"},
+					FieldLines: map[string]int{"Front": 12},
+				},
+			},
+		},
+		{
+			name:     "front matter not closed",
+			data:     matter,
+			wantErr:  "front matter is not closed",
+			wantLine: 1,
+		},
+		{
+			name:     "front matter empty",
+			data:     "---\n---\n# Q\n",
+			wantErr:  "front matter is empty",
+			wantLine: 1,
+		},
+		{
+			name:     "unknown setting",
+			data:     "---\ndeck_name: Go\nunknown: x\n---\n",
+			wantErr:  "field unknown not found",
+			wantLine: 3,
+		},
+		{
+			name:     "notes in the front matter",
+			data:     matter + "notes: [{fields: {Front: x}}]\n---\n",
+			wantErr:  "notes of a Markdown deck are its sections",
+			wantLine: 1,
+		},
+		{
+			name:     "text before the first note",
+			data:     matter + "---\nintro\n# Q\n",
+			wantErr:  "text before the first note heading",
+			wantLine: 6,
+		},
+		{
+			name:     "text without fields",
+			data:     matter + "---\n# Q\nanswer\n",
+			wantErr:  "needs field sub-headings or `fields`",
+			wantLine: 6,
+		},
+		{
+			name:     "more parts than fields",
+			data:     matter + "fields: [Back]\n---\n# Q\na\n---\nb\n",
+			wantErr:  "note has 2 parts but the front matter lists 1 fields",
+			wantLine: 7,
+		},
+		{
+			name:     "field set twice",
+			data:     matter + "---\n# Q\n## Back\na\n## Back\nb\n",
+			wantErr:  `field "Back" is set more than once`,
+			wantLine: 9,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deck, errs := parseMarkdownDeck("go.md", []byte(tt.data))
+			if tt.wantErr != "" {
+				if len(errs) != 1 || !strings.Contains(errs[0].Reason, tt.wantErr) || errs[0].Line != tt.wantLine {
+					t.Fatalf("parseMarkdownDeck() errors = %v, want %q at line %d", errs, tt.wantErr, tt.wantLine)
+				}
+				return
+			}
+			if len(errs) > 0 {
+				t.Fatalf("parseMarkdownDeck() errors = %v", errs)
+			}
+			if deck.Deck != "Go" || deck.Format != tt.wantFormat || !deck.ReadOnly || deck.Source != "go.md" {
+				t.Errorf("parseMarkdownDeck() deck = %+v, want the settings of Go in %s", deck, tt.wantFormat)
+			}
+			if !reflect.DeepEqual(deck.Notes, tt.wantNotes) {
+				t.Errorf("parseMarkdownDeck() notes = %+v, want %+v", deck.Notes, tt.wantNotes)
+			}
+		})
+	}
+}
+
+func TestHasFrontMatter(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{data: "---\ndeck_name: Go\n---\n", want: true},
+		{data: "--- \r\n", want: true},
+		{data: "# README\n---\n"},
+		{data: ""},
+	}
+	for _, tt := range tests {
+		if got := hasFrontMatter([]byte(tt.data)); got != tt.want {
+			t.Errorf("hasFrontMatter(%q) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
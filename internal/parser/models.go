@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/spigell/anki-sync/internal/anki"
+)
+
+// LoadModels parses the models at path. The path is a models file, a
+// directory of them, descended into when recursive is set, or a glob. A file
+// lists its models under `models:` or holds a single model. Model names must
+// be unique across all files.
+func LoadModels(path string, recursive bool) ([]anki.Model, error) {
+	files, err := modelFiles(path, recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		models []anki.Model
+		errs   []*ParseError
+	)
+	for _, file := range files {
+		ms, fileErrs, err := loadModelFile(file)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, fileErrs...)
+
+		for _, m := range ms {
+			i := slices.IndexFunc(models, func(o anki.Model) bool { return o.Name == m.Name })
+			if i >= 0 {
+				errs = append(errs, &ParseError{
+					Path:   m.Source,
+					Line:   m.Line,
+					Reason: fmt.Sprintf("model %q is already defined at %s:%d", m.Name, models[i].Source, models[i].Line),
+				})
+				continue
+			}
+			models = append(models, m)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("failed to load models: %w", joinParseErrors(errs))
+	}
+	return models, nil
+}
+
+// modelFiles lists the model files at path in a stable order.
+func modelFiles(path string, recursive bool) ([]string, error) {
+	if strings.ContainsAny(path, "*?[") {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid models pattern %q: %w", path, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no model files match %q", path)
+		}
+		return matches, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != path && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(p); ext == ".yaml" || ext == ".yml" {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no model files found in %s", path)
+	}
+	return files, nil
+}
+
+// loadModelFile parses the models of a single file and reads the files
+// they refer to.
+func loadModelFile(path string) ([]anki.Model, []*ParseError, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	root := document(data)
+	if k, _ := lookup(root, "models"); k == nil && root != nil {
+		var model anki.Model
+		if err := decodeStrict(data, &model); err != nil {
+			return nil, parseErrors(path, err), nil
+		}
+		model.Source = path
+		annotateModel(root, &model)
+		models := []anki.Model{model}
+		return models, resolveModelFiles(path, models), nil
+	}
+
+	var wrap struct {
+		Models []anki.Model `yaml:"models"`
+	}
+	if err := decodeStrict(data, &wrap); err != nil {
+		return nil, parseErrors(path, err), nil
+	}
+	for i := range wrap.Models {
+		wrap.Models[i].Source = path
+	}
+	annotateModels(root, wrap.Models)
+	return wrap.Models, resolveModelFiles(path, wrap.Models), nil
+}
+
+// decodeStrict decodes YAML rejecting unknown keys.
+func decodeStrict(data []byte, v any) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	return dec.Decode(v)
+}
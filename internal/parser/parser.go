@@ -1,40 +1,180 @@
 package parser
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 
 	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/render"
 )
 
 type DeckParsed struct {
 	Deck   anki.Deck
 	Parsed bool
 	Path   string
+	// Errors explain why the file could not be parsed.
+	Errors []*ParseError
 }
 
 var ErrDeckIsNotParseble = errors.New("deck file is not parseble")
 
-func LoadModels(path string) ([]anki.Model, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
+// yamlLine matches the position yaml.v3 puts into its error messages.
+var yamlLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// ParseError is a problem decoding a source file.
+type ParseError struct {
+	Path string
+	// Line is 0 when the decoder did not report a position.
+	Line   int
+	Reason string
+	// Err is the error returned by the decoder.
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Reason)
 	}
-	defer f.Close()
-	var wrap struct {
-		Models []anki.Model `yaml:"models"`
+	return fmt.Sprintf("%s: %s", e.Path, e.Reason)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseErrors splits a decoder error into positioned errors. Type errors,
+// unknown fields among them, report every offending line at once.
+func parseErrors(path string, err error) []*ParseError {
+	if errors.Is(err, io.EOF) {
+		return []*ParseError{{Path: path, Reason: "file is empty", Err: err}}
+	}
+
+	messages := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+
+	errs := make([]*ParseError, 0, len(messages))
+	for _, msg := range messages {
+		e := &ParseError{Path: path, Reason: strings.TrimPrefix(msg, "yaml: "), Err: err}
+		if m := yamlLine.FindStringSubmatch(msg); m != nil {
+			e.Line, _ = strconv.Atoi(m[1])
+			e.Reason = m[2]
+		}
+		errs = append(errs, e)
 	}
-	dec := yaml.NewDecoder(f)
+	return errs
+}
+
+// parseYAMLDeck decodes a deck file in the YAML format.
+func parseYAMLDeck(path string, data []byte) (anki.Deck, []*ParseError) {
+	var deck anki.Deck
+	dec := yaml.NewDecoder(bytes.NewReader(data))
 	dec.KnownFields(true)
-	if err := dec.Decode(&wrap); err != nil {
-		return nil, fmt.Errorf("failed to parse models: %w", err)
+	if err := dec.Decode(&deck); err != nil {
+		return deck, parseErrors(path, err)
+	}
+	deck.Source = path
+	annotateDeck(document(data), &deck)
+	return deck, nil
+}
+
+// expandCloze fills the primary field of notes written with the cloze shorthand.
+func expandCloze(path string, deck *anki.Deck) []*ParseError {
+	var errs []*ParseError
+	for i := range deck.Notes {
+		note := &deck.Notes[i]
+		if note.Cloze == "" {
+			continue
+		}
+		fail := func(reason string) {
+			errs = append(errs, &ParseError{Path: path, Line: note.Line, Reason: fmt.Sprintf("note %d: %s", i+1, reason)})
+		}
+		if deck.PrimaryField == "" {
+			fail("cloze needs the primary_field of the deck to expand into")
+			continue
+		}
+		if _, ok := note.Fields[deck.PrimaryField]; ok {
+			fail(fmt.Sprintf("cloze and field %q are both set", deck.PrimaryField))
+			continue
+		}
+		text, err := anki.ExpandCloze(note.Cloze)
+		if err != nil {
+			fail(err.Error())
+			continue
+		}
+		if note.Fields == nil {
+			note.Fields = make(map[string]string)
+		}
+		note.Fields[deck.PrimaryField] = text
 	}
-	return wrap.Models, nil
+	return errs
+}
+
+// renderFields converts the note fields written in Markdown to HTML. The
+// rendered HTML is what sync compares with Anki, keeping re-syncs idempotent.
+func renderFields(path string, deck *anki.Deck) []*ParseError {
+	var errs []*ParseError
+	check := func(format string, line int) {
+		if format != anki.FormatHTML && format != anki.FormatMarkdown {
+			errs = append(errs, &ParseError{Path: path, Line: line, Reason: fmt.Sprintf("unknown format %q, expected %s or %s", format, anki.FormatHTML, anki.FormatMarkdown)})
+		}
+	}
+	if deck.Format != "" {
+		check(deck.Format, deck.Lines["format"])
+	}
+	for _, field := range slices.Sorted(maps.Keys(deck.FieldFormats)) {
+		check(deck.FieldFormats[field], deck.Lines["field_formats"])
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	for i := range deck.Notes {
+		note := &deck.Notes[i]
+		for field, value := range note.Fields {
+			if deck.FieldFormat(field) != anki.FormatMarkdown {
+				continue
+			}
+			html, err := render.Markdown(value)
+			if err != nil {
+				line := note.FieldLines[field]
+				if line == 0 {
+					line = note.Line
+				}
+				errs = append(errs, &ParseError{Path: path, Line: line, Reason: fmt.Sprintf("note %d: field %q: %v", i+1, field, err), Err: err})
+				continue
+			}
+			if note.Rendered == nil {
+				note.Rendered = make(map[string]string)
+			}
+			note.Rendered[field] = value
+			note.Fields[field] = html
+		}
+	}
+	return errs
+}
+
+// joinParseErrors combines parse errors into a single error.
+func joinParseErrors(errs []*ParseError) error {
+	joined := make([]error, len(errs))
+	for i, e := range errs {
+		joined[i] = e
+	}
+	return errors.Join(joined...)
 }
 
 //nolint:gocognit // To do.
@@ -42,22 +182,35 @@ func LoadDecks(path string, recursive bool) ([]DeckParsed, error) {
 	var decks []DeckParsed
 
 	processFile := func(p string) error {
-		if ext := filepath.Ext(p); ext != ".yaml" && ext != ".yml" {
+		var parse func(string, []byte) (anki.Deck, []*ParseError)
+		switch ext := filepath.Ext(p); {
+		case (ext == ".yaml" || ext == ".yml") && !isSidecar(p):
+			parse = parseYAMLDeck
+		case IsTable(p):
+			parse = parseTableDeck
+		case ext == ".md":
+			parse = parseMarkdownDeck
+		default:
 			return nil
 		}
 
-		f, err := os.Open(p)
+		data, err := os.ReadFile(p)
 		if err != nil {
 			return fmt.Errorf("could not open deck file %s: %w", p, err)
 		}
-		defer f.Close()
+		// Markdown files without front matter, like a README, aren't decks.
+		if filepath.Ext(p) == ".md" && !hasFrontMatter(data) {
+			return nil
+		}
 
 		decks = append(decks, DeckParsed{Path: p})
 
-		var deck anki.Deck
-		dec := yaml.NewDecoder(f)
-		dec.KnownFields(true)
-		if err := dec.Decode(&deck); err != nil {
+		deck, errs := parse(p, data)
+		if len(errs) == 0 {
+			errs = append(expandCloze(p, &deck), renderFields(p, &deck)...)
+		}
+		if len(errs) > 0 {
+			decks[len(decks)-1].Errors = errs
 			return ErrDeckIsNotParseble
 		}
 		decks[len(decks)-1].Parsed = true
@@ -118,8 +271,3 @@ func LoadDecks(path string, recursive bool) ([]DeckParsed, error) {
 	}
 	return decks, nil
 }
-
-func ValidateNotes(_ []anki.Deck, _ []anki.Model) []error {
-	// TODO: Check fields, model existence, etc.
-	return nil
-}
@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"gopkg.in/yaml.v3"
+
+	"github.com/spigell/anki-sync/internal/anki"
+)
+
+// document returns the top level mapping of a YAML document, or nil.
+// The data is expected to have been decoded successfully already.
+func document(data []byte) *yaml.Node {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil || len(root.Content) == 0 {
+		return nil
+	}
+	if n := root.Content[0]; n.Kind == yaml.MappingNode {
+		return n
+	}
+	return nil
+}
+
+// lookup returns the key and value nodes of a mapping entry.
+func lookup(n *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i], n.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// items returns the elements of a sequence node.
+func items(n *yaml.Node) []*yaml.Node {
+	if n == nil || n.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return n.Content
+}
+
+// annotateDeck records where the deck settings and notes are in the file.
+func annotateDeck(root *yaml.Node, deck *anki.Deck) {
+	if root == nil {
+		return
+	}
+
+	deck.Lines = make(map[string]int, len(root.Content)/2)
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		deck.Lines[root.Content[i].Value] = root.Content[i].Line
+	}
+
+	_, notes := lookup(root, "notes")
+	for i, item := range items(notes) {
+		if i >= len(deck.Notes) {
+			break
+		}
+		note := &deck.Notes[i]
+		note.Line = item.Line
+
+		_, fields := lookup(item, "fields")
+		if fields == nil || fields.Kind != yaml.MappingNode {
+			continue
+		}
+		note.FieldLines = make(map[string]int, len(fields.Content)/2)
+		for j := 0; j+1 < len(fields.Content); j += 2 {
+			note.FieldLines[fields.Content[j].Value] = fields.Content[j].Line
+		}
+	}
+}
+
+// annotateModels records where the models and their templates are in the file.
+func annotateModels(root *yaml.Node, models []anki.Model) {
+	_, list := lookup(root, "models")
+	for i, item := range items(list) {
+		if i >= len(models) {
+			break
+		}
+		annotateModel(item, &models[i])
+	}
+}
+
+// annotateModel records where a model, its fields and templates are.
+func annotateModel(item *yaml.Node, model *anki.Model) {
+	model.Line = item.Line
+
+	_, fields := lookup(item, "fields")
+	for _, f := range items(fields) {
+		name, from := f.Value, ""
+		if f.Kind == yaml.MappingNode {
+			name, from, _ = anki.FieldSpec(f)
+		}
+		if model.FieldLines == nil {
+			model.FieldLines = make(map[string]int)
+		}
+		model.FieldLines[name] = f.Line
+		if from != "" {
+			if model.RenamedFrom == nil {
+				model.RenamedFrom = make(map[string]string)
+			}
+			model.RenamedFrom[name] = from
+		}
+	}
+
+	_, templates := lookup(item, "cardTemplates")
+	for j, t := range items(templates) {
+		if j >= len(model.CardTemplates) {
+			break
+		}
+		model.CardTemplates[j].Line = t.Line
+	}
+}
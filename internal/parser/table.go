@@ -0,0 +1,177 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spigell/anki-sync/internal/anki"
+)
+
+// Table columns that aren't note fields.
+const (
+	// TagsColumn holds the tags of a note, separated by spaces.
+	TagsColumn = "tags"
+	// IDColumn holds the id of a note, see anki.Note.ID.
+	IDColumn = "id"
+)
+
+// IsTable reports whether path is a CSV or TSV deck file.
+func IsTable(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".csv" || ext == ".tsv"
+}
+
+// isSidecar reports whether a YAML file is the header of a table deck, such
+// as words.csv.yaml for words.csv, rather than a deck of its own.
+func isSidecar(path string) bool {
+	return IsTable(strings.TrimSuffix(path, filepath.Ext(path)))
+}
+
+// parseTableDeck decodes a CSV or TSV deck file. The deck settings come from
+// a sidecar YAML file or the comment lines the table starts with; the first
+// row names the fields of the columns, apart from the tags and id columns.
+//
+//	# deck_name: English
+//	# model_name: Basic
+//	# primary_field: Front
+//	Front,Back,tags
+//	cat,кошка,animals
+func parseTableDeck(path string, data []byte) (anki.Deck, []*ParseError) {
+	fail := func(line int, format string, args ...any) []*ParseError {
+		return []*ParseError{{Path: path, Line: line, Reason: fmt.Sprintf(format, args...)}}
+	}
+
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	header, body, offset := splitComments(data)
+
+	deck, errs := tableHeader(path, header)
+	if errs != nil {
+		return deck, errs
+	}
+	if len(deck.Notes) > 0 {
+		return deck, fail(deck.Lines["notes"], "notes of a table deck are the rows of the table")
+	}
+	deck.Source = path
+	deck.ReadOnly = true
+
+	r := csv.NewReader(bytes.NewReader(body))
+	if filepath.Ext(path) == ".tsv" {
+		r.Comma = '\t'
+		r.LazyQuotes = true
+	}
+
+	columns, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return deck, fail(offset+1, "table has no header row")
+	}
+	if err != nil {
+		return deck, tableError(path, offset, err)
+	}
+	for i, c := range columns {
+		columns[i] = strings.TrimSpace(c)
+		switch {
+		case columns[i] == "":
+			return deck, fail(offset+1, "column %d has no name", i+1)
+		case slices.Contains(columns[:i], columns[i]):
+			return deck, fail(offset+1, "column %q appears more than once", columns[i])
+		}
+	}
+
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return deck, tableError(path, offset, err)
+		}
+
+		line, _ := r.FieldPos(0)
+		note := anki.Note{
+			Fields:     make(map[string]string, len(columns)),
+			Line:       offset + line,
+			FieldLines: make(map[string]int, len(columns)),
+		}
+		for i, value := range record {
+			switch columns[i] {
+			case TagsColumn:
+				note.Tags = strings.Fields(value)
+				continue
+			case IDColumn:
+				note.ID = strings.TrimSpace(value)
+				continue
+			}
+			note.Fields[columns[i]] = value
+			note.FieldLines[columns[i]] = note.Line
+		}
+		deck.Notes = append(deck.Notes, note)
+	}
+	return deck, nil
+}
+
+// splitComments separates the comment lines a table starts with, without
+// their `#`, from the table. offset is the number of lines split off.
+func splitComments(data []byte) ([]byte, []byte, int) {
+	var header bytes.Buffer
+	offset := 0
+	for len(data) > 0 && data[0] == '#' {
+		line, rest, _ := bytes.Cut(data, []byte("\n"))
+		line = bytes.TrimPrefix(bytes.TrimPrefix(line, []byte("#")), []byte(" "))
+		header.Write(bytes.TrimSuffix(line, []byte("\r")))
+		header.WriteByte('\n')
+		data = rest
+		offset++
+	}
+	return header.Bytes(), data, offset
+}
+
+// tableHeader decodes the deck settings of a table from its comment lines
+// or, without them, from its sidecar file.
+func tableHeader(path string, comments []byte) (anki.Deck, []*ParseError) {
+	source, data := path, comments
+	for _, ext := range []string{".yaml", ".yml"} {
+		sidecar, err := os.ReadFile(path + ext)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return anki.Deck{}, []*ParseError{{Path: path + ext, Reason: err.Error(), Err: err}}
+		}
+		if len(bytes.TrimSpace(comments)) > 0 {
+			return anki.Deck{}, []*ParseError{{Path: path, Line: 1, Reason: fmt.Sprintf("deck settings are given both in comments and in %s", path+ext)}}
+		}
+		source, data = path+ext, sidecar
+		break
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return anki.Deck{}, []*ParseError{{Path: path, Line: 1, Reason: fmt.Sprintf("deck settings are missing, start the table with `# deck_name: ...` lines or add %s.yaml", filepath.Base(path))}}
+	}
+
+	var deck anki.Deck
+	if err := decodeStrict(data, &deck); err != nil {
+		return deck, parseErrors(source, err)
+	}
+	// Line numbers of the sidecar file don't apply to the table.
+	if source == path {
+		annotateDeck(document(data), &deck)
+	}
+	return deck, nil
+}
+
+// tableError positions a CSV error in the table file.
+func tableError(path string, offset int, err error) []*ParseError {
+	e := &ParseError{Path: path, Reason: err.Error(), Err: err}
+	var csvErr *csv.ParseError
+	if errors.As(err, &csvErr) {
+		e.Line = offset + csvErr.Line
+		e.Reason = csvErr.Err.Error()
+	}
+	return []*ParseError{e}
+}
@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spigell/anki-sync/internal/anki"
+)
+
+func TestParseTableDeck(t *testing.T) {
+	const header = "# deck_name: English\n# model_name: Basic\n# primary_field: Front\n"
+
+	tests := []struct {
+		name      string
+		file      string
+		sidecar   string
+		data      string
+		wantNotes []anki.Note
+		wantErr   string
+		wantLine  int
+	}{
+		{
+			name: "csv with comments",
+			file: "words.csv",
+			data: header + "Front,Back,tags,id\ncat,кошка,animals pets,c1\n\"a, b\",\"multi\nline\",,\n",
+			wantNotes: []anki.Note{
+				{
+					ID: "c1", Fields: map[string]string{"Front": "cat", "Back": "кошка"}, Tags: []string{"animals", "pets"},
+					Line: 5, FieldLines: map[string]int{"Front": 5, "Back": 5},
+				},
+				{
+					Fields: map[string]string{"Front": "a, b", "Back": "multi\nline"}, Tags: []string{},
+					Line: 6, FieldLines: map[string]int{"Front": 6, "Back": 6},
+				},
+			},
+		},
+		{
+			name:    "tsv with sidecar and BOM",
+			file:    "words.tsv",
+			sidecar: "deck_name: English\nmodel_name: Basic\nprimary_field: Front\n",
+			data:    "\ufeffFront\tBack\ncat\ta \"quoted\" кошка\n",
+			wantNotes: []anki.Note{{
+				Fields: map[string]string{"Front": "cat", "Back": `a "quoted" кошка`},
+				Line:   2, FieldLines: map[string]int{"Front": 2, "Back": 2},
+			}},
+		},
+		{
+			name:     "settings missing",
+			file:     "words.csv",
+			data:     "Front,Back\ncat,кошка\n",
+			wantErr:  "deck settings are missing",
+			wantLine: 1,
+		},
+		{
+			name:     "settings given twice",
+			file:     "words.csv",
+			sidecar:  "deck_name: English\n",
+			data:     header + "Front,Back\n",
+			wantErr:  "both in comments and in",
+			wantLine: 1,
+		},
+		{
+			name:     "notes in the settings",
+			file:     "words.csv",
+			data:     header + "# notes: [{fields: {Front: cat}}]\nFront,Back\n",
+			wantErr:  "notes of a table deck are the rows",
+			wantLine: 4,
+		},
+		{
+			name:     "no header row",
+			file:     "words.csv",
+			data:     header,
+			wantErr:  "no header row",
+			wantLine: 4,
+		},
+		{
+			name:     "duplicate column",
+			file:     "words.csv",
+			data:     header + "Front,Back,Front\n",
+			wantErr:  `column "Front" appears more than once`,
+			wantLine: 4,
+		},
+		{
+			name:     "unnamed column",
+			file:     "words.csv",
+			data:     header + "Front,,Back\n",
+			wantErr:  "column 2 has no name",
+			wantLine: 4,
+		},
+		{
+			name:     "wrong number of fields",
+			file:     "words.csv",
+			data:     header + "Front,Back\ncat,кошка\ndog\n",
+			wantErr:  "wrong number of fields",
+			wantLine: 6,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if tt.sidecar != "" {
+				if err := os.WriteFile(path+".yaml", []byte(tt.sidecar), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			deck, errs := parseTableDeck(path, []byte(tt.data))
+			if tt.wantErr != "" {
+				if len(errs) != 1 || !strings.Contains(errs[0].Reason, tt.wantErr) || errs[0].Line != tt.wantLine {
+					t.Fatalf("parseTableDeck() errors = %v, want %q at line %d", errs, tt.wantErr, tt.wantLine)
+				}
+				return
+			}
+			if len(errs) > 0 {
+				t.Fatalf("parseTableDeck() errors = %v", errs)
+			}
+			if deck.Deck != "English" || deck.PrimaryField != "Front" || !deck.ReadOnly || deck.Source != path {
+				t.Errorf("parseTableDeck() deck = %+v, want the settings of English", deck)
+			}
+			if !reflect.DeepEqual(deck.Notes, tt.wantNotes) {
+				t.Errorf("parseTableDeck() notes = %+v, want %+v", deck.Notes, tt.wantNotes)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/render"
+)
+
+// ErrUnknownModel is wrapped by the errors of decks using a model that is not
+// among the validated models.
+var ErrUnknownModel = errors.New("unknown model")
+
+var (
+	// templateRef matches a replacement, conditional or filter in a card template.
+	templateRef = regexp.MustCompile(`\{\{([^{}]+)\}\}`)
+	// clozeDeletion matches the start of a cloze deletion in a field value.
+	clozeDeletion = regexp.MustCompile(`\{\{c\d+::`)
+	// noteID matches the ids that are valid as a part of an Anki tag.
+	noteID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+)
+
+// builtinFields are the names Anki provides to every template.
+var builtinFields = map[string]bool{
+	"FrontSide": true,
+	"Tags":      true,
+	"Type":      true,
+	"Deck":      true,
+	"Subdeck":   true,
+	"Card":      true,
+	"CardFlag":  true,
+	"CardID":    true,
+}
+
+// ValidationError is a problem found in a source file.
+type ValidationError struct {
+	Path string
+	// Line is 0 when the problem can't be tied to a line.
+	Line int
+	Err  error
+}
+
+func (e *ValidationError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %v", e.Path, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateNotes checks decks against the models they use and the models
+// against themselves. It doesn't talk to Anki: models that only exist there
+// must be passed in models, otherwise decks using them get an error wrapping
+// ErrUnknownModel.
+func ValidateNotes(decks []anki.Deck, models []anki.Model) []error {
+	var errs []error
+
+	byName := make(map[string]anki.Model, len(models))
+	for _, m := range models {
+		if _, ok := byName[m.Name]; !ok {
+			byName[m.Name] = m
+		}
+		if m.Source != "" {
+			errs = append(errs, validateModel(m)...)
+		}
+	}
+
+	// Primary values and ids seen per deck name, as decks may span several files.
+	seen := make(map[string]map[string]string)
+	ids := make(map[string]map[string]string)
+
+	for _, deck := range decks {
+		errs = append(errs, validateDeck(deck, byName, seen, ids)...)
+	}
+	return errs
+}
+
+func validateModel(m anki.Model) []error {
+	var errs []error
+	fail := func(line int, format string, args ...any) {
+		errs = append(errs, &ValidationError{Path: m.Source, Line: line, Err: fmt.Errorf(format, args...)})
+	}
+
+	fields := make(map[string]bool, len(m.InOrderFields))
+	for _, f := range m.InOrderFields {
+		if fields[f] {
+			fail(m.FieldLines[f], "model %q declares field %q more than once", m.Name, f)
+		}
+		fields[f] = true
+	}
+
+	renamed := make(map[string]string, len(m.RenamedFrom))
+	for _, f := range m.InOrderFields {
+		from, ok := m.RenamedFrom[f]
+		if !ok {
+			continue
+		}
+		switch {
+		case fields[from]:
+			fail(m.FieldLines[f], "field %q of model %q is renamed from %q, which is still declared", f, m.Name, from)
+		case renamed[from] != "":
+			fail(m.FieldLines[f], "fields %q and %q of model %q are both renamed from %q", renamed[from], f, m.Name, from)
+		default:
+			renamed[from] = f
+		}
+	}
+
+	templates := make(map[string]bool, len(m.CardTemplates))
+	for _, t := range m.CardTemplates {
+		if templates[t.Name] {
+			fail(t.Line, "model %q declares template %q more than once", m.Name, t.Name)
+		}
+		templates[t.Name] = true
+	}
+	for _, t := range m.CardTemplates {
+		if t.RenamedFrom != "" && templates[t.RenamedFrom] {
+			fail(t.Line, "template %q of model %q is renamed from %q, which is still declared", t.Name, m.Name, t.RenamedFrom)
+		}
+	}
+
+	cloze := false
+	for _, t := range m.CardTemplates {
+		for _, side := range []struct{ name, text string }{{"front", t.Front}, {"back", t.Back}} {
+			for _, ref := range TemplateFields(side.text) {
+				if !fields[ref] {
+					fail(t.Line, "template %q of model %q: %s references undeclared field %q", t.Name, m.Name, side.name, ref)
+				}
+			}
+		}
+		cloze = cloze || strings.Contains(t.Front, "{{cloze:")
+	}
+
+	if m.IsCloze && !cloze {
+		fail(m.Line, "cloze model %q has no {{cloze:...}} field in its front templates", m.Name)
+	}
+	if m.CodeTheme != "" && !render.IsTheme(m.CodeTheme) {
+		fail(m.Line, "model %q: unknown code_theme %q", m.Name, m.CodeTheme)
+	}
+	return errs
+}
+
+func validateDeck(deck anki.Deck, models map[string]anki.Model, seen, ids map[string]map[string]string) []error {
+	var errs []error
+	fail := func(line int, format string, args ...any) {
+		errs = append(errs, &ValidationError{Path: deck.Source, Line: line, Err: fmt.Errorf(format, args...)})
+	}
+
+	if deck.Deck == "" {
+		fail(0, "deck_name is not set")
+	}
+	if deck.Model == "" {
+		fail(0, "model_name is not set")
+		return errs
+	}
+	model, ok := models[deck.Model]
+	if !ok {
+		fail(deck.Lines["model_name"], "%w %q", ErrUnknownModel, deck.Model)
+		return errs
+	}
+
+	switch {
+	case deck.PrimaryField == "":
+		fail(0, "primary_field is not set")
+	case !slices.Contains(model.InOrderFields, deck.PrimaryField):
+		fail(deck.Lines["primary_field"], "primary field %q is not a field of model %q", deck.PrimaryField, model.Name)
+	}
+
+	for _, field := range slices.Sorted(maps.Keys(deck.FieldFormats)) {
+		if !slices.Contains(model.InOrderFields, field) {
+			fail(deck.Lines["field_formats"], "field_formats: %q is not a field of model %q", field, model.Name)
+		}
+	}
+
+	cloze := IsCloze(model)
+	if seen[deck.Deck] == nil {
+		seen[deck.Deck] = make(map[string]string)
+		ids[deck.Deck] = make(map[string]string)
+	}
+
+	for i, note := range deck.Notes {
+		line := note.Line
+
+		names := make([]string, 0, len(note.Fields))
+		for name := range note.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !slices.Contains(model.InOrderFields, name) {
+				fieldLine := note.FieldLines[name]
+				if fieldLine == 0 {
+					fieldLine = line
+				}
+				fail(fieldLine, "note %d: field %q is not a field of model %q", i+1, name, model.Name)
+			}
+		}
+
+		if deck.PrimaryField != "" {
+			// Notes differing only in their cloze markup are the same note to lookups.
+			value := strings.TrimSpace(anki.StripCloze(note.Fields[deck.PrimaryField]))
+			if value == "" {
+				fail(line, "note %d: primary field %q is missing or empty", i+1, deck.PrimaryField)
+			} else if first, dup := seen[deck.Deck][value]; dup {
+				fail(line, "note %d: duplicate primary field value %q in deck %q, first defined at %s", i+1, value, deck.Deck, first)
+			} else {
+				seen[deck.Deck][value] = fmt.Sprintf("%s:%d", deck.Source, line)
+			}
+		}
+
+		if note.ID != "" {
+			if !noteID.MatchString(note.ID) {
+				fail(line, "note %d: id %q may contain only letters, digits, '.', '_' and '-'", i+1, note.ID)
+			} else if first, dup := ids[deck.Deck][note.ID]; dup {
+				fail(line, "note %d: duplicate id %q in deck %q, first defined at %s", i+1, note.ID, deck.Deck, first)
+			} else {
+				ids[deck.Deck][note.ID] = fmt.Sprintf("%s:%d", deck.Source, line)
+			}
+		}
+
+		switch {
+		case cloze && !hasCloze(note):
+			fail(line, "note %d: model %q is a cloze model but the note has no cloze deletions", i+1, model.Name)
+		case !cloze && note.Cloze != "":
+			fail(line, "note %d: cloze is set but model %q is not a cloze model", i+1, model.Name)
+		}
+	}
+	return errs
+}
+
+// TemplateFields returns the note fields referenced by a card template,
+// without the fields Anki provides itself.
+func TemplateFields(template string) []string {
+	var fields []string
+	for _, m := range templateRef.FindAllStringSubmatch(template, -1) {
+		ref := strings.TrimSpace(m[1])
+		if ref == "" || strings.HasPrefix(ref, "!") || strings.HasPrefix(ref, "=") {
+			continue
+		}
+		ref = strings.TrimLeft(ref, "#^/")
+		// Filters come first: {{hint:Field}}, {{cloze:Text}}, {{text:furigana:Field}}.
+		if i := strings.LastIndex(ref, ":"); i >= 0 {
+			ref = ref[i+1:]
+		}
+		ref = strings.TrimSpace(ref)
+		if ref == "" || builtinFields[ref] || slices.Contains(fields, ref) {
+			continue
+		}
+		fields = append(fields, ref)
+	}
+	return fields
+}
+
+// IsCloze reports whether notes of the model are expected to have cloze deletions.
+func IsCloze(m anki.Model) bool {
+	if m.IsCloze {
+		return true
+	}
+	for _, t := range m.CardTemplates {
+		if strings.Contains(t.Front, "{{cloze:") {
+			return true
+		}
+	}
+	return false
+}
+
+func hasCloze(note anki.Note) bool {
+	for _, v := range note.Fields {
+		if clozeDeletion.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
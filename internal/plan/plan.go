@@ -0,0 +1,117 @@
+// Package plan describes the changes a sync would make to Anki.
+package plan
+
+// Action is the kind of change applied to an object.
+type Action string
+
+const (
+	Create  Action = "create"
+	Update  Action = "update"
+	Delete  Action = "delete"
+	Suspend Action = "suspend"
+	Rename  Action = "rename"
+	Move    Action = "move"
+)
+
+// Plan is the full changeset of a sync run.
+type Plan struct {
+	Models []ModelChange `json:"models"`
+	Decks  []DeckChange  `json:"decks"`
+	Notes  []NoteChange  `json:"notes"`
+	// Errors are problems with single objects that kept them out of the plan.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// TextChange is a value before and after the sync.
+type TextChange struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// TemplateChange is a change of the card templates of a model: a template
+// added, renamed or deleted, or an update of one side of a template.
+type TemplateChange struct {
+	Action Action `json:"action"`
+	Name   string `json:"name"`
+	// From is the previous name of a renamed template.
+	From string `json:"from,omitempty"`
+	// Side and Diff describe updates.
+	Side string      `json:"side,omitempty"`
+	Diff *TextChange `json:"diff,omitempty"`
+}
+
+// FieldChange is a change of the fields of a model, applied in order.
+type FieldChange struct {
+	// Action is Create, Rename, Delete or Move.
+	Action Action `json:"action"`
+	Name   string `json:"name"`
+	// From is the previous name of a renamed field.
+	From string `json:"from,omitempty"`
+	// Position is the index of the field once the change is applied, or
+	// before it for deleted fields.
+	Position int `json:"position"`
+}
+
+type ModelChange struct {
+	Name      string           `json:"name"`
+	Action    Action           `json:"action"`
+	Fields    []FieldChange    `json:"fields,omitempty"`
+	Templates []TemplateChange `json:"templates,omitempty"`
+	CSS       *TextChange      `json:"css,omitempty"`
+}
+
+type DeckChange struct {
+	Name   string `json:"name"`
+	Action Action `json:"action"`
+}
+
+type NoteChange struct {
+	Deck   string `json:"deck"`
+	Model  string `json:"model"`
+	Action Action `json:"action"`
+	// Key identifies the note in the source, e.g. `Front="Hello"`.
+	Key         string                `json:"key"`
+	NoteID      int64                 `json:"note_id,omitempty"`
+	Fields      map[string]TextChange `json:"fields,omitempty"`
+	TagsAdded   []string              `json:"tags_added,omitempty"`
+	TagsRemoved []string              `json:"tags_removed,omitempty"`
+}
+
+// Summary counts changes by their kind.
+type Summary struct {
+	Create int `json:"create"`
+	Update int `json:"update"`
+	// Remove counts pruned notes, deleted or suspended.
+	Remove int `json:"remove"`
+}
+
+// Empty reports whether the plan has no changes.
+func (p *Plan) Empty() bool {
+	return len(p.Models) == 0 && len(p.Decks) == 0 && len(p.Notes) == 0
+}
+
+// Summary counts the planned changes.
+func (p *Plan) Summary() Summary {
+	var s Summary
+	count := func(a Action) {
+		switch a {
+		case Create:
+			s.Create++
+		case Update:
+			s.Update++
+		case Delete, Suspend:
+			s.Remove++
+		}
+	}
+
+	for _, m := range p.Models {
+		count(m.Action)
+	}
+	for _, d := range p.Decks {
+		count(d.Action)
+	}
+	for _, n := range p.Notes {
+		count(n.Action)
+	}
+	return s
+}
@@ -0,0 +1,188 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	colorReset  = "\033[0m"
+	colorBold   = "\033[1m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorCyan   = "\033[36m"
+)
+
+// Renderer writes a plan for humans, Terraform style.
+type Renderer struct {
+	w     io.Writer
+	color bool
+}
+
+func NewRenderer(w io.Writer, color bool) *Renderer {
+	return &Renderer{w: w, color: color}
+}
+
+// Render prints every change followed by a summary line.
+func (r *Renderer) Render(p *Plan) {
+	defer r.renderErrors(p.Errors)
+
+	if p.Empty() {
+		r.printf("%s\n", r.paint(colorGreen, "No changes. Anki is up-to-date."))
+		return
+	}
+
+	r.printf("anki-sync will perform the following actions:\n")
+
+	for _, m := range p.Models {
+		r.renderModel(m)
+	}
+	for _, d := range p.Decks {
+		r.header(d.Action, fmt.Sprintf("deck %q", d.Name))
+	}
+	for _, n := range p.Notes {
+		r.renderNote(n)
+	}
+
+	s := p.Summary()
+	r.printf("\n%s %d to create, %d to update, %d to remove.\n", r.paint(colorBold, "Plan:"), s.Create, s.Update, s.Remove)
+}
+
+func (r *Renderer) renderErrors(errs []string) {
+	for _, e := range errs {
+		r.printf("\n%s %s\n", r.paint(colorRed, "Error:"), e)
+	}
+}
+
+func (r *Renderer) renderModel(m ModelChange) {
+	r.header(m.Action, fmt.Sprintf("model %q", m.Name))
+
+	for _, f := range m.Fields {
+		switch f.Action {
+		case Create:
+			r.printf("  %s field %q at position %d\n", r.paint(colorGreen, "+"), f.Name, f.Position+1)
+		case Rename:
+			r.printf("  %s field %q renamed to %q\n", r.paint(colorYellow, "~"), f.From, f.Name)
+		case Delete:
+			r.printf("  %s field %q and its contents in every note\n", r.paint(colorRed, "-"), f.Name)
+		case Move:
+			r.printf("  %s field %q moved to position %d\n", r.paint(colorYellow, "~"), f.Name, f.Position+1)
+		}
+	}
+	for _, t := range m.Templates {
+		switch t.Action {
+		case Create:
+			r.printf("  %s template %q\n", r.paint(colorGreen, "+"), t.Name)
+		case Rename:
+			r.printf("  %s template %q renamed to %q\n", r.paint(colorYellow, "~"), t.From, t.Name)
+		case Delete:
+			r.printf("  %s template %q and its cards with their review history\n", r.paint(colorRed, "-"), t.Name)
+		default:
+			r.printf("  %s template %q %s\n", r.paint(colorYellow, "~"), t.Name, t.Side)
+			r.diff(*t.Diff)
+		}
+	}
+	if m.CSS != nil {
+		r.printf("  %s css\n", r.paint(colorYellow, "~"))
+		r.diff(*m.CSS)
+	}
+}
+
+func (r *Renderer) renderNote(n NoteChange) {
+	title := fmt.Sprintf("note %s in deck %q", n.Key, n.Deck)
+	if n.NoteID != 0 {
+		title += fmt.Sprintf(" (id %d)", n.NoteID)
+	}
+	r.header(n.Action, title)
+
+	names := make([]string, 0, len(n.Fields))
+	for name := range n.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		change := n.Fields[name]
+		if n.Action == Create {
+			r.printf("  %s %s: %s\n", r.paint(colorGreen, "+"), name, oneLine(change.After))
+			continue
+		}
+		r.printf("  %s field %q\n", r.paint(colorYellow, "~"), name)
+		r.diff(change)
+	}
+	for _, t := range n.TagsAdded {
+		r.printf("  %s tag %s\n", r.paint(colorGreen, "+"), t)
+	}
+	for _, t := range n.TagsRemoved {
+		r.printf("  %s tag %s\n", r.paint(colorRed, "-"), t)
+	}
+}
+
+func (r *Renderer) header(a Action, what string) {
+	switch a {
+	case Create:
+		r.printf("\n%s %s will be created\n", r.paint(colorGreen, "+"), r.paint(colorBold, what))
+	case Update:
+		r.printf("\n%s %s will be updated in-place\n", r.paint(colorYellow, "~"), r.paint(colorBold, what))
+	case Delete:
+		r.printf("\n%s %s will be deleted\n", r.paint(colorRed, "-"), r.paint(colorBold, what))
+	case Suspend:
+		r.printf("\n%s %s will be suspended\n", r.paint(colorRed, "-"), r.paint(colorBold, what))
+	}
+}
+
+func (r *Renderer) diff(c TextChange) {
+	for _, line := range UnifiedDiff(c.Before, c.After) {
+		switch line[0] {
+		case '@':
+			line = r.paint(colorCyan, line)
+		case '-':
+			line = r.paint(colorRed, line)
+		case '+':
+			line = r.paint(colorGreen, line)
+		}
+		r.printf("      %s\n", line)
+	}
+}
+
+func (r *Renderer) paint(color, s string) string {
+	if !r.color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+func (r *Renderer) printf(format string, args ...any) {
+	fmt.Fprintf(r.w, format, args...)
+}
+
+// WriteJSON writes the plan as indented JSON.
+func WriteJSON(w io.Writer, p *Plan) error {
+	out := struct {
+		Plan
+		Summary Summary `json:"summary"`
+	}{*p, p.Summary()}
+
+	// Keep lists as arrays for consumers that do not expect null.
+	if out.Models == nil {
+		out.Models = []ModelChange{}
+	}
+	if out.Decks == nil {
+		out.Decks = []DeckChange{}
+	}
+	if out.Notes == nil {
+		out.Notes = []NoteChange{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func oneLine(s string) string {
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
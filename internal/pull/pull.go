@@ -0,0 +1,329 @@
+// Package pull writes edits made in Anki back into the deck files.
+package pull
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"go.uber.org/zap"
+
+	"github.com/spigell/anki-sync/internal/anki"
+	"github.com/spigell/anki-sync/internal/deck"
+	"github.com/spigell/anki-sync/internal/logging"
+	"github.com/spigell/anki-sync/internal/media"
+	"github.com/spigell/anki-sync/internal/state"
+)
+
+// tagsField names the tags in changes and conflicts.
+const tagsField = "tags"
+
+// Change is a value taken from Anki into a deck file.
+type Change struct {
+	Path string
+	Line int
+	Deck string
+	Key  string
+	// Field is the field name, or "tags".
+	Field  string
+	Before string
+	After  string
+}
+
+// Conflict is a value changed both in the deck file and in Anki since the
+// last sync, or one that differs without a recorded sync to compare with.
+type Conflict struct {
+	Path  string
+	Line  int
+	Deck  string
+	Key   string
+	Field string
+	Ours  string
+	Anki  string
+}
+
+// Result lists what a pull changed and what it could not decide.
+type Result struct {
+	Changes   []Change
+	Conflicts []Conflict
+	// Rendered are fields edited in Anki whose deck value is rendered to
+	// HTML, they are left alone even with --force.
+	Rendered []Conflict
+}
+
+type Puller struct {
+	ctx    context.Context
+	client anki.Connector
+	state  *state.State
+	dryRun bool
+	force  bool
+	logger *logging.Logger
+}
+
+type PullerOption func(*Puller)
+
+func NewPuller(ctx context.Context, client anki.Connector, st *state.State, dryRun bool, logger *logging.Logger, opts ...PullerOption) *Puller {
+	p := &Puller{
+		ctx:    ctx,
+		client: client,
+		state:  st,
+		dryRun: dryRun,
+		logger: logger,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// WithForce resolves conflicts in favour of Anki.
+func WithForce(force bool) PullerOption {
+	return func(p *Puller) {
+		p.force = force
+	}
+}
+
+// local is a source note prepared for comparison with Anki.
+type local struct {
+	index int
+	note  anki.Note
+	// resolved is the note as sync would send it.
+	resolved anki.Note
+	files    []media.File
+	base     state.Note
+	hasBase  bool
+	id       int64
+}
+
+// Pull compares the notes of the decks with Anki and writes the values that
+// were changed only in Anki back into the deck files. The state is updated
+// for every value that ends up equal on both sides.
+func (p *Puller) Pull(decks []anki.Deck) (*Result, error) {
+	res := &Result{}
+	edits := make(map[string][]edit)
+
+	for _, d := range decks {
+		if d.ReadOnly {
+			p.logger.Warn("deck file can't be written, edits made in Anki are not pulled", zap.String("file", d.Source))
+			continue
+		}
+		if err := p.pullDeck(d, res, edits); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.dryRun {
+		return res, nil
+	}
+
+	paths := make([]string, 0, len(edits))
+	for path := range edits {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := apply(path, edits[path]); err != nil {
+			return nil, fmt.Errorf("error while writing %s: %w", path, err)
+		}
+		p.logger.Info("deck file updated", zap.String("file", path), zap.Int("changes", len(edits[path])))
+	}
+
+	return res, nil
+}
+
+func (p *Puller) pullDeck(d anki.Deck, res *Result, edits map[string][]edit) error {
+	notes, err := p.localNotes(d)
+	if err != nil {
+		return err
+	}
+	byID, err := p.notesInfo(d, notes)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range notes {
+		info, ok := byID[l.id]
+		if !ok || !slices.Contains(info.Tags, deck.NoteTag) {
+			continue
+		}
+		p.pullNote(d, l, info, res, edits)
+	}
+	return nil
+}
+
+// localNotes prepares the notes of a deck and finds their IDs, from the
+// state or, for notes it doesn't know, by looking them up in Anki. Notes
+// missing in Anki keep a zero ID.
+func (p *Puller) localNotes(d anki.Deck) ([]*local, error) {
+	logger := p.logger.CloneWith(zap.String("deck", d.Deck))
+
+	var (
+		notes   []*local
+		lookups []*local
+		search  []anki.NoteSearch
+	)
+	for i, note := range d.Notes {
+		resolved, files, err := media.Resolve(filepath.Dir(d.Source), note)
+		if err != nil {
+			logger.Warn("note is skipped", zap.String("primary_field", note.Fields[d.PrimaryField]), zap.Error(err))
+			continue
+		}
+		resolved.Tags = deck.Tags(note)
+
+		l := &local{index: i, note: note, resolved: resolved, files: files}
+		l.base, l.hasBase = p.state.Get(d.Deck, resolved.Fields[d.PrimaryField])
+		if l.hasBase && l.base.NoteID != 0 {
+			l.id = l.base.NoteID
+		} else {
+			lookups = append(lookups, l)
+			search = append(search, deck.Lookup(d, resolved))
+		}
+		notes = append(notes, l)
+	}
+	if len(lookups) == 0 {
+		return notes, nil
+	}
+
+	found, err := deck.NotesExist(p.ctx, p.client, d.Deck, search, deck.DefaultBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting status of notes in deck %s: %w", d.Deck, err)
+	}
+	for i, f := range found {
+		if f.Err == nil && f.Exists {
+			lookups[i].id = f.ID
+		}
+	}
+	return notes, nil
+}
+
+// notesInfo fetches the Anki side of the notes found in Anki, by note ID.
+func (p *Puller) notesInfo(d anki.Deck, notes []*local) (map[int64]anki.NoteInfo, error) {
+	var ids []int64
+	for _, l := range notes {
+		if l.id != 0 {
+			ids = append(ids, l.id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	infos, err := deck.NotesInfo(p.ctx, p.client, ids, deck.DefaultBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting notes of deck %s: %w", d.Deck, err)
+	}
+	byID := make(map[int64]anki.NoteInfo, len(infos))
+	for _, info := range infos {
+		byID[info.NoteID] = info
+	}
+	return byID, nil
+}
+
+// pullNote merges a single note. A value is taken from Anki when only Anki
+// changed it since the last sync; values changed only in the source are left
+// for the next sync to push.
+func (p *Puller) pullNote(d anki.Deck, l *local, info anki.NoteInfo, res *Result, edits map[string][]edit) {
+	base := l.base
+	if !l.hasBase {
+		base = state.Note{Deck: d.Deck}
+	}
+	base.NoteID = info.NoteID
+	base.Key = l.resolved.Fields[d.PrimaryField]
+	settled := true
+
+	line := func(field string) int {
+		if n := l.note.FieldLines[field]; n > 0 {
+			return n
+		}
+		return l.note.Line
+	}
+
+	names := make([]string, 0, len(l.resolved.Fields))
+	for name := range l.resolved.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		ours := l.resolved.Fields[name]
+		current, ok := info.Fields[name]
+		if !ok {
+			continue
+		}
+		theirs := current.Value
+
+		switch {
+		case ours == theirs:
+			base.SetField(name, theirs)
+		case l.hasBase && base.FieldSynced(name, theirs):
+			// Changed in the source only, sync pushes it.
+			settled = false
+		case l.note.Rendered[name] != "":
+			// HTML can't be turned back into the Markdown source.
+			res.Rendered = append(res.Rendered, Conflict{
+				Path: d.Source, Line: line(name), Deck: d.Deck, Key: l.note.Fields[d.PrimaryField],
+				Field: name, Ours: l.note.Rendered[name], Anki: theirs,
+			})
+			settled = false
+		case (l.hasBase && base.FieldSynced(name, ours)) || p.force:
+			pulled := media.Unresolve(theirs, l.files)
+			res.Changes = append(res.Changes, Change{
+				Path: d.Source, Line: line(name), Deck: d.Deck, Key: l.note.Fields[d.PrimaryField],
+				Field: name, Before: l.note.Fields[name], After: pulled,
+			})
+			edits[d.Source] = append(edits[d.Source], edit{note: l.index, field: name, value: pulled})
+			base.SetField(name, theirs)
+			if name == d.PrimaryField {
+				// The state follows the primary value the source gets.
+				base.Key = theirs
+			}
+		default:
+			res.Conflicts = append(res.Conflicts, Conflict{
+				Path: d.Source, Line: line(name), Deck: d.Deck, Key: l.note.Fields[d.PrimaryField],
+				Field: name, Ours: l.note.Fields[name], Anki: theirs,
+			})
+			settled = false
+		}
+	}
+
+	oursTags := state.HashTags(l.resolved.Tags)
+	theirsTags := state.HashTags(info.Tags)
+	switch {
+	case oursTags == theirsTags:
+		base.Tags = theirsTags
+	case l.hasBase && base.Tags == theirsTags:
+		settled = false
+	case (l.hasBase && base.Tags == oursTags) || p.force:
+		tags := make([]string, 0, len(info.Tags))
+		for _, t := range info.Tags {
+			if !deck.IsManagedTag(t) {
+				tags = append(tags, t)
+			}
+		}
+		res.Changes = append(res.Changes, Change{
+			Path: d.Source, Line: l.note.Line, Deck: d.Deck, Key: l.note.Fields[d.PrimaryField],
+			Field: tagsField, Before: fmt.Sprint(l.note.Tags), After: fmt.Sprint(tags),
+		})
+		edits[d.Source] = append(edits[d.Source], edit{note: l.index, tags: tags, setTags: true})
+		base.Tags = theirsTags
+	default:
+		res.Conflicts = append(res.Conflicts, Conflict{
+			Path: d.Source, Line: l.note.Line, Deck: d.Deck, Key: l.note.Fields[d.PrimaryField],
+			Field: tagsField, Ours: fmt.Sprint(l.note.Tags), Anki: fmt.Sprint(info.Tags),
+		})
+		settled = false
+	}
+
+	// Without a recorded sync only a fully settled note gets a state.
+	if p.dryRun || (!l.hasBase && !settled) {
+		return
+	}
+	if l.hasBase {
+		p.state.Forget(d.Deck, l.base.Key)
+	}
+	p.state.Put(base)
+}
@@ -0,0 +1,155 @@
+package pull
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/spigell/anki-sync/internal/anki"
+)
+
+// edit is a change of a single note in a deck file.
+type edit struct {
+	// note is the index of the note in the file.
+	note  int
+	field string
+	value string
+
+	tags    []string
+	setTags bool
+}
+
+// apply rewrites the deck file through its YAML node tree, so comments, key
+// order and the style of untouched values are kept.
+func apply(path string, edits []edit) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return err
+	}
+	if len(root.Content) == 0 {
+		return fmt.Errorf("empty document")
+	}
+	notes := value(root.Content[0], "notes")
+	if notes == nil || notes.Kind != yaml.SequenceNode {
+		return fmt.Errorf("no notes")
+	}
+
+	for _, e := range edits {
+		if e.note >= len(notes.Content) {
+			return fmt.Errorf("note %d not found", e.note+1)
+		}
+		note := notes.Content[e.note]
+
+		if e.setTags {
+			setTags(note, e.tags)
+			continue
+		}
+
+		node := value(value(note, "fields"), e.field)
+		if node == nil {
+			// Only the primary field is written as the cloze shorthand.
+			if cloze := value(note, "cloze"); cloze != nil {
+				setCloze(note, cloze, e.field, e.value)
+				continue
+			}
+			return fmt.Errorf("note %d: field %s not found", e.note+1, e.field)
+		}
+		setScalar(node, e.value)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&root); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), info.Mode().Perm())
+}
+
+// value returns the value node of a mapping entry.
+func value(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setScalar replaces the value of a string node. Block styles are kept for
+// multi-line values only.
+func setScalar(n *yaml.Node, v string) {
+	n.Kind = yaml.ScalarNode
+	n.Tag = "!!str"
+	n.Value = v
+	n.Content = nil
+
+	multiline := strings.Contains(v, "\n")
+	switch {
+	case multiline && n.Style != yaml.LiteralStyle && n.Style != yaml.FoldedStyle:
+		n.Style = yaml.LiteralStyle
+	case !multiline && (n.Style == yaml.LiteralStyle || n.Style == yaml.FoldedStyle):
+		n.Style = 0
+	}
+}
+
+// setCloze stores a pulled cloze field in the shorthand of the note, or in
+// its fields when the shorthand can't express the value.
+func setCloze(note, cloze *yaml.Node, field, v string) {
+	if short, ok := anki.CompactCloze(v); ok {
+		setScalar(cloze, short)
+		return
+	}
+
+	for i := 0; i+1 < len(note.Content); i += 2 {
+		if note.Content[i+1] == cloze {
+			note.Content = append(note.Content[:i], note.Content[i+2:]...)
+			break
+		}
+	}
+	fields := value(note, "fields")
+	if fields == nil {
+		fields = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		note.Content = append(note.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "fields"}, fields)
+	}
+	node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str"}
+	setScalar(node, v)
+	fields.Content = append(fields.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: field}, node)
+}
+
+func setTags(note *yaml.Node, tags []string) {
+	seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for _, t := range tags {
+		seq.Content = append(seq.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: t})
+	}
+
+	if current := value(note, "tags"); current != nil {
+		seq.Style = current.Style
+		seq.LineComment = current.LineComment
+		*current = *seq
+		return
+	}
+	seq.Style = yaml.FlowStyle
+	note.Content = append(note.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "tags"},
+		seq,
+	)
+}
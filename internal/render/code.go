@@ -0,0 +1,77 @@
+package render
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// DefaultTheme is the highlight theme of models that don't choose one.
+const DefaultTheme = "github"
+
+var (
+	// fence matches a fenced code block written directly into an HTML field.
+	fence = regexp.MustCompile("(?ms)^```[ \t]*([\\w+#.-]*)[ \t]*\r?\n(.*?)\r?\n```[ \t]*$")
+	// codeBlock matches a code block rendered from Markdown.
+	codeBlock = regexp.MustCompile(`(?s)<pre><code(?: class="language-([\w+#.-]+)")?>(.*?)</code></pre>`)
+
+	// formatter writes inline styles, cards work without a stylesheet or
+	// JavaScript on every Anki client.
+	formatter = chromahtml.New(chromahtml.TabWidth(4))
+)
+
+// IsTheme reports whether name is a known highlight theme.
+func IsTheme(name string) bool {
+	_, ok := styles.Registry[name]
+	return ok
+}
+
+// Code highlights the fenced code blocks and the code blocks rendered from
+// Markdown in a field value. It reports whether the value had any.
+func Code(value, theme string) (string, bool, error) {
+	style := styles.Get(theme)
+	var (
+		found bool
+		err   error
+	)
+	replace := func(re *regexp.Regexp, value string, code func(string) string) string {
+		return re.ReplaceAllStringFunc(value, func(block string) string {
+			m := re.FindStringSubmatch(block)
+			out, herr := highlight(m[1], code(m[2]), style)
+			if herr != nil {
+				err = herr
+				return block
+			}
+			found = true
+			return out
+		})
+	}
+
+	value = replace(codeBlock, value, html.UnescapeString)
+	value = replace(fence, value, func(s string) string { return s })
+	if err != nil {
+		return "", false, err
+	}
+	return value, found, nil
+}
+
+func highlight(language, code string, style *chroma.Style) (string, error) {
+	lexer := lexers.Get(language)
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	it, err := chroma.Coalesce(lexer).Tokenise(nil, strings.TrimSuffix(code, "\n"))
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := formatter.Format(&b, style, it); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
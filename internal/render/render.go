@@ -0,0 +1,45 @@
+// Package render turns note fields written in other formats into the HTML
+// Anki stores.
+package render
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+var (
+	markdown = goldmark.New(
+		goldmark.WithExtensions(extension.Table, extension.Strikethrough, extension.TaskList),
+		// Raw HTML is passed on to the sanitizer rather than dropped.
+		goldmark.WithRendererOptions(html.WithUnsafe()),
+	)
+	policy = func() *bluemonday.Policy {
+		p := bluemonday.UGCPolicy()
+		// The language of code blocks picks their highlighting, see Code.
+		p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#.-]+$`)).OnElements("code")
+		return p
+	}()
+)
+
+// Markdown renders a Markdown field value to sanitized HTML. A value that is
+// a single paragraph is not wrapped into <p>, so short fields stay inline.
+func Markdown(src string) (string, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(src), &buf); err != nil {
+		return "", err
+	}
+	out := strings.TrimSpace(policy.Sanitize(buf.String()))
+
+	if inner, ok := strings.CutPrefix(out, "<p>"); ok {
+		if inner, ok = strings.CutSuffix(inner, "</p>"); ok && !strings.Contains(inner, "<p>") {
+			return inner, nil
+		}
+	}
+	return out, nil
+}
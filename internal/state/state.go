@@ -0,0 +1,270 @@
+// Package state records what the last sync wrote to Anki, so later runs can
+// tell which side changed a note since then.
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spigell/anki-sync/internal/anki"
+)
+
+const version = 1
+
+// hashLen is the number of hex digits kept of a content hash.
+const hashLen = 16
+
+// Note is the synced state of a single note. Contents are stored as hashes:
+// the state tells whether a value changed, not what it was.
+type Note struct {
+	Deck string `json:"deck"`
+	// Key is the primary field value of the note.
+	Key string `json:"key"`
+	// Source identifies the note in the sources independently of its
+	// primary field value, see SourceKey.
+	Source string `json:"source,omitempty"`
+	NoteID int64  `json:"note_id"`
+	// Hash is the content hash of the whole note, see ContentHash.
+	Hash string `json:"hash,omitempty"`
+	// Fields maps field names to hashes of their values as written to Anki.
+	Fields map[string]string `json:"fields"`
+	Tags   string            `json:"tags"`
+}
+
+// State is the content of a state file. It is safe for concurrent use.
+type State struct {
+	mu    sync.Mutex
+	notes map[string]Note
+	// sources maps source keys to note keys.
+	sources map[string]string
+}
+
+type file struct {
+	Version int    `json:"version"`
+	Notes   []Note `json:"notes"`
+}
+
+// New returns an empty state.
+func New() *State {
+	return &State{
+		notes:   make(map[string]Note),
+		sources: make(map[string]string),
+	}
+}
+
+// Load reads a state file. A missing file is an empty state.
+func Load(path string) (*State, error) {
+	s := New()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	if f.Version != version {
+		return nil, fmt.Errorf("state file %s has unsupported version %d", path, f.Version)
+	}
+	for _, n := range f.Notes {
+		s.put(n)
+	}
+	return s, nil
+}
+
+// Save writes the state atomically, with notes in a stable order.
+func (s *State) Save(path string) error {
+	f := file{Version: version, Notes: s.Notes()}
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get returns the state of the note with the given primary field value.
+func (s *State) Get(deck, key string) (Note, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.notes[id(deck, key)]
+	return n, ok
+}
+
+// BySource returns the state of the note recorded under a source key.
+func (s *State) BySource(deck, source string) (Note, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.sources[id(deck, source)]
+	if !ok {
+		return Note{}, false
+	}
+	n, ok := s.notes[id(deck, key)]
+	return n, ok
+}
+
+// Notes returns all recorded notes ordered by deck and key.
+func (s *State) Notes() []Note {
+	s.mu.Lock()
+	notes := make([]Note, 0, len(s.notes))
+	for _, n := range s.notes {
+		notes = append(notes, n)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(notes, func(i, j int) bool {
+		if notes[i].Deck != notes[j].Deck {
+			return notes[i].Deck < notes[j].Deck
+		}
+		return notes[i].Key < notes[j].Key
+	})
+	return notes
+}
+
+// Record stores a note as it is in Anki after a sync. Fields and tags must
+// be the values sent to Anki, i.e. with media references resolved.
+func (s *State) Record(deck, key, source string, noteID int64, note anki.Note) {
+	n := Note{
+		Deck:   deck,
+		Key:    key,
+		Source: source,
+		NoteID: noteID,
+		Hash:   ContentHash(note),
+		Fields: make(map[string]string, len(note.Fields)),
+		Tags:   HashTags(note.Tags),
+	}
+	for name, value := range note.Fields {
+		n.Fields[name] = Hash(value)
+	}
+
+	s.Put(n)
+}
+
+// Put stores the state of a note.
+func (s *State) Put(n Note) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(n)
+}
+
+func (s *State) put(n Note) {
+	s.notes[id(n.Deck, n.Key)] = n
+	if n.Source != "" {
+		s.sources[id(n.Deck, n.Source)] = n.Key
+	}
+}
+
+// Forget removes the state of a note.
+func (s *State) Forget(deck, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.notes[id(deck, key)]
+	if !ok {
+		return
+	}
+	delete(s.notes, id(deck, key))
+	if s.sources[id(deck, n.Source)] == key {
+		delete(s.sources, id(deck, n.Source))
+	}
+}
+
+// FieldSynced reports whether value is what the last sync wrote to the field.
+func (n Note) FieldSynced(name, value string) bool {
+	h, ok := n.Fields[name]
+	return ok && h == Hash(value)
+}
+
+// TagsSynced reports whether tags are what the last sync wrote to the note.
+func (n Note) TagsSynced(tags []string) bool {
+	return n.Tags == HashTags(tags)
+}
+
+// SetField records value as the synced value of a field.
+func (n *Note) SetField(name, value string) {
+	fields := make(map[string]string, len(n.Fields)+1)
+	for k, v := range n.Fields {
+		fields[k] = v
+	}
+	fields[name] = Hash(value)
+	n.Fields = fields
+}
+
+// SourceKey identifies a note by its position in a deck file, which survives
+// edits of its primary field.
+func SourceKey(path string, index int) string {
+	return fmt.Sprintf("%s#%d", filepath.ToSlash(path), index+1)
+}
+
+// IDKey identifies a note with an id in the sources, wherever it is.
+func IDKey(id string) string {
+	return "id:" + id
+}
+
+// ContentHash hashes all fields and tags of a note.
+func ContentHash(note anki.Note) string {
+	names := make([]string, 0, len(note.Fields))
+	for name := range note.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%q=%q\n", name, note.Fields[name])
+	}
+	fmt.Fprintf(h, "tags=%s\n", HashTags(note.Tags))
+	return hex.EncodeToString(h.Sum(nil))[:hashLen]
+}
+
+// Hash returns the content hash of a value.
+func Hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])[:hashLen]
+}
+
+// HashTags hashes a tag list regardless of order and duplicates.
+func HashTags(tags []string) string {
+	set := make([]string, 0, len(tags))
+	for _, t := range tags {
+		if t != "" && !slices.Contains(set, t) {
+			set = append(set, t)
+		}
+	}
+	sort.Strings(set)
+	return Hash(strings.Join(set, " "))
+}
+
+func id(deck, key string) string {
+	return deck + "\x00" + key
+}